@@ -14,7 +14,7 @@ func TestRemove(t *testing.T) {
 	cb := New[string]()
 
 	for i := 0; i < 30; i++ {
-		cb.Add(func(msg string) bool {
+		cb.Subscribe(func(msg string) bool {
 			if rand.Intn(1000) == 1 {
 				fmt.Printf("remove\n")
 				return false
@@ -0,0 +1,54 @@
+package request
+
+import (
+	"net/url"
+	"sync/atomic"
+)
+
+// Balancer picks hosts in round-robin order. A host listed several times gets a bigger share of requests.
+// It is safe for concurrent use and is meant to be shared by all requests to the same service.
+type Balancer struct {
+	hosts []string
+	n     atomic.Uint64
+}
+
+// NewBalancer makes a balancer for hosts given as "host:port" or as base urls like "https://host:port".
+func NewBalancer(hosts ...string) *Balancer {
+	return &Balancer{hosts: hosts}
+}
+
+func (b *Balancer) next() string {
+	return b.hosts[(b.n.Add(1)-1)%uint64(len(b.hosts))]
+}
+
+// rewrite sets the host, and the scheme if given, of the next balancer host into u.
+func (b *Balancer) rewrite(u *url.URL) {
+	if len(b.hosts) == 0 {
+		return
+	}
+
+	h := b.next()
+
+	hu, err := url.Parse(h)
+	if err != nil || hu.Host == "" {
+		u.Host = h
+
+		return
+	}
+
+	u.Scheme = hu.Scheme
+	u.Host = hu.Host
+}
+
+// BalanceHosts replaces the host of the request url with the next of hosts every time this request is sent.
+// Hosts rotate for this Request only, use BalanceWith to share the rotation between requests.
+func (r *Request) BalanceHosts(hosts []string) *Request {
+	return r.BalanceWith(NewBalancer(hosts...))
+}
+
+// BalanceWith replaces the host of the request url with the next host of b every time the request is sent.
+func (r *Request) BalanceWith(b *Balancer) *Request {
+	r.balancer = b
+
+	return r
+}
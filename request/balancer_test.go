@@ -0,0 +1,48 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBalanceHosts(t *testing.T) {
+	var got []string
+
+	newSrv := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = append(got, name+r.URL.Path)
+		}))
+	}
+
+	s1, s2 := newSrv("a"), newSrv("b")
+	defer s1.Close()
+	defer s2.Close()
+
+	b := NewBalancer(s1.URL, strings.TrimPrefix(s2.URL, "http://"))
+
+	for i := 0; i < 4; i++ {
+		if _, err := New(http.DefaultClient, nil).URL("http://api.invalid/items").BalanceWith(b).GetBody(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := []string{"a/items", "b/items", "a/items", "b/items"}; !slices.Equal(got, want) {
+		t.Errorf("got %v", got)
+	}
+	got = nil
+	req := New(http.DefaultClient, nil).URL("http://api.invalid/other").BalanceHosts([]string{s2.URL, s1.URL})
+
+	for i := 0; i < 3; i++ {
+		if _, err := req.GetBody(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := []string{"b/other", "a/other", "b/other"}; !slices.Equal(got, want) {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,347 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// PatchOp is a single RFC 6902 json patch operation.
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// MarshalJSON always writes value of add, replace and test operations, RFC 6902 requires it even if it is null.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	type patchOp PatchOp
+
+	switch op.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			patchOp
+			Value any `json:"value"`
+		}{patchOp(op), op.Value})
+	default:
+		return json.Marshal(patchOp(op))
+	}
+}
+
+// FormValues sets url encoded form body, keeping all values of multi-valued fields.
+func (r *Request) FormValues(v url.Values) *Request {
+	r.body = strings.NewReader(v.Encode())
+
+	return r.AddHeader("Content-Type", "application/x-www-form-urlencoded")
+}
+
+// JSONPatch sets PATCH method and RFC 6902 json patch body. Invalid operations are reported when the request is sent,
+// unless another body is set later.
+func (r *Request) JSONPatch(ops []PatchOp) *Request {
+	r.method = http.MethodPatch
+
+	for _, op := range ops {
+		switch op.Op {
+		case "add", "remove", "replace", "test":
+		case "move", "copy":
+			if op.From == "" {
+				r.body, r.bodyErr = nil, fmt.Errorf("json patch operation %q without from", op.Op)
+
+				return r
+			}
+		default:
+			r.body, r.bodyErr = nil, fmt.Errorf("invalid json patch operation %q", op.Op)
+
+			return r
+		}
+	}
+
+	b, err := json.Marshal(ops)
+	if err != nil {
+		r.body, r.bodyErr = nil, err
+
+		return r
+	}
+
+	r.body = bytes.NewReader(b)
+
+	return r.AddHeader("Content-Type", "application/json-patch+json")
+}
+
+// BodyFunc sets function making the request body, it is called only when the request is built for sending,
+// after the circuit breaker check. fn error aborts the request.
+func (r *Request) BodyFunc(fn func() (io.Reader, error)) *Request {
+	r.bodyFn = fn
+
+	return r
+}
+
+// ProtoBodyFunc sets protobuf body made with marshal, e.g. func() ([]byte, error) { return proto.Marshal(msg) }.
+// Marshal errors are returned when the request is sent.
+func (r *Request) ProtoBodyFunc(marshal func() ([]byte, error)) *Request {
+	b, err := marshal()
+	if err != nil {
+		r.body, r.bodyErr = nil, err
+
+		return r
+	}
+
+	r.body = bytes.NewReader(b)
+
+	return r.AddHeader("Content-Type", "application/x-protobuf")
+}
+
+// NDJSONBodyFromChan streams values from ch as newline delimited json, encoding them as the transport reads the body.
+// Closing ch ends the body.
+func (r *Request) NDJSONBodyFromChan(ch <-chan any) *Request {
+	r.bodyFn = func() (io.Reader, error) {
+		pr, pw := io.Pipe()
+
+		go func() {
+			enc := json.NewEncoder(pw)
+
+			for v := range ch {
+				if err := enc.Encode(v); err != nil {
+					pw.CloseWithError(err)
+
+					return
+				}
+			}
+
+			pw.Close()
+		}()
+
+		return pr, nil
+	}
+
+	return r.AddHeader("Content-Type", "application/x-ndjson")
+}
+
+// JSONArrayBody streams items as json array, encoding elements one by one as the transport reads the body.
+// The streamed body can't be replayed, so Retry, Fallback and RefreshOn401 can't resend it.
+func (r *Request) JSONArrayBody(items []any) *Request {
+	r.bodyFn = func() (io.Reader, error) {
+		pr, pw := io.Pipe()
+
+		go func() {
+			enc := json.NewEncoder(pw)
+
+			if _, err := pw.Write([]byte("[")); err != nil {
+				return
+			}
+
+			for i, v := range items {
+				if i > 0 {
+					if _, err := pw.Write([]byte(",")); err != nil {
+						return
+					}
+				}
+
+				if err := enc.Encode(v); err != nil {
+					pw.CloseWithError(err)
+
+					return
+				}
+			}
+
+			_, _ = pw.Write([]byte("]"))
+			pw.Close()
+		}()
+
+		return pr, nil
+	}
+
+	return r.AddHeader("Content-Type", "application/json")
+}
+
+// BodyFile sends the file as request body. The file is opened when the request is sent and closed after it,
+// open errors are returned from DoRes.
+func (r *Request) BodyFile(path string) *Request {
+	r.file = path
+
+	return r
+}
+
+func (r *Request) setBodyFile(req *http.Request) error {
+	f, err := os.Open(r.file)
+	if err != nil {
+		return err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	req.ContentLength = st.Size()
+	req.Body = f
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(r.file)
+	}
+
+	if st.Size() == 0 {
+		f.Close()
+		req.Body = http.NoBody
+	}
+
+	return nil
+}
+
+// BufferBody reads the body into memory before sending, so it can be replayed on retries, fallbacks and 307/308 redirects.
+// The whole body is kept in memory until the request is done.
+func (r *Request) BufferBody() *Request {
+	r.buffer = true
+
+	return r
+}
+
+// CompressIfLarger gzips the body and sets "Content-Encoding: gzip" if the body is longer than threshold bytes.
+// The body is buffered to check its size.
+func (r *Request) CompressIfLarger(threshold int) *Request {
+	r.compress = &threshold
+
+	return r
+}
+
+func compressBody(req *http.Request, threshold int) error {
+	b, err := bufferBody(req)
+	if err != nil || len(b) <= threshold {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(b)
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	setBodyBytes(req, buf.Bytes())
+	req.Header.Set("Content-Encoding", "gzip")
+
+	return nil
+}
+
+// HMACSign sets header to "sha256=<hex>" of HMAC-SHA256 of the body with the secret. The body is buffered to compute it.
+func (r *Request) HMACSign(header, secret string) *Request {
+	return r.HMACSignPrefix(header, secret, "sha256=")
+}
+
+// HMACSignPrefix is like HMACSign with custom prefix before hex signature.
+func (r *Request) HMACSignPrefix(header, secret, prefix string) *Request {
+	r.sign = &hmacSign{header: header, secret: secret, prefix: prefix}
+
+	return r
+}
+
+type hmacSign struct {
+	header string
+	secret string
+	prefix string
+}
+
+func (s *hmacSign) apply(req *http.Request) error {
+	b, err := bufferBody(req)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write(b)
+	req.Header.Set(s.header, s.prefix+hex.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
+
+// bufferBody reads request body into memory and sets it back as replayable one.
+func bufferBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	setBodyBytes(req, b)
+
+	return b, nil
+}
+
+func setBodyBytes(req *http.Request, b []byte) {
+	req.ContentLength = int64(len(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		if len(b) == 0 {
+			return http.NoBody, nil
+		}
+
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	req.Body, _ = req.GetBody()
+}
+
+// WithContentMD5 sets Content-MD5 header with base64 md5 of the body. The body is buffered to compute it.
+func (r *Request) WithContentMD5() *Request {
+	r.md5 = true
+
+	return r
+}
+
+// VerifyContentMD5 makes reading of the response body fail at the end if it doesn't match response Content-MD5 header.
+func (r *Request) VerifyContentMD5() *Request {
+	r.checkMD5 = true
+
+	return r
+}
+
+func setContentMD5(req *http.Request) error {
+	b, err := bufferBody(req)
+	if err != nil {
+		return err
+	}
+
+	sum := md5.Sum(b)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	return nil
+}
+
+type md5Body struct {
+	io.ReadCloser
+	want string
+	h    hash.Hash
+}
+
+func (b *md5Body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.h.Write(p[:n])
+
+	if errors.Is(err, io.EOF) {
+		if got := base64.StdEncoding.EncodeToString(b.h.Sum(nil)); got != b.want {
+			return n, fmt.Errorf("body md5 %s doesn't match Content-MD5 %s", got, b.want)
+		}
+	}
+
+	return n, err
+}
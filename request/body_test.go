@@ -0,0 +1,527 @@
+package request
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormValues(t *testing.T) {
+	var (
+		body string
+		tags []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+
+		r.Body = io.NopCloser(strings.NewReader(body))
+		_ = r.ParseForm()
+		tags = r.PostForm["tag"]
+	}))
+	defer srv.Close()
+
+	v := url.Values{"tag": {"a", "b"}, "name": {"x y"}}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Post().FormValues(v).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "name=x+y&tag=a&tag=b" {
+		t.Errorf("got body %q", body)
+	}
+
+	if !slices.Equal(tags, []string{"a", "b"}) {
+		t.Errorf("got tags %v", tags)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	var (
+		method, ct string
+		body       []byte
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		ct = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	ops := []PatchOp{
+		{Op: "replace", Path: "/name", Value: "new"},
+		{Op: "remove", Path: "/tmp"},
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).JSONPatch(ops).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPatch || ct != "application/json-patch+json" {
+		t.Errorf("got %s with content type %q", method, ct)
+	}
+
+	if want := `[{"op":"replace","path":"/name","value":"new"},{"op":"remove","path":"/tmp"}]`; string(body) != want {
+		t.Errorf("got body %s", body)
+	}
+
+	ops = []PatchOp{
+		{Op: "add", Path: "/x", Value: nil},
+		{Op: "move", Path: "/y", From: "/x"},
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).JSONPatch(ops).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `[{"op":"add","path":"/x","value":null},{"op":"move","path":"/y","from":"/x"}]`; string(body) != want {
+		t.Errorf("got body %s", body)
+	}
+
+	for _, op := range []PatchOp{{Op: "update", Path: "/a"}, {Op: "copy", Path: "/a"}} {
+		if _, err := New(srv.Client(), nil).URL(srv.URL).JSONPatch([]PatchOp{op}).GetBody(context.Background()); err == nil {
+			t.Errorf("expected error for %s operation", op.Op)
+		}
+	}
+
+	// a body set after the invalid patch replaces it
+	req := New(srv.Client(), nil).URL(srv.URL).JSONPatch([]PatchOp{{Op: "update", Path: "/a"}})
+
+	if _, err := req.JSONPatch(ops[:1]).GetBody(context.Background()); err != nil || string(body) != `[{"op":"add","path":"/x","value":null}]` {
+		t.Errorf("got %s, %v", body, err)
+	}
+}
+
+func TestNDJSONBodyFromChan(t *testing.T) {
+	type rec struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	var (
+		got []rec
+		ct  string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct = r.Header.Get("Content-Type")
+		dec := json.NewDecoder(r.Body)
+
+		for {
+			var v rec
+			if err := dec.Decode(&v); err != nil {
+				break
+			}
+
+			got = append(got, v)
+		}
+	}))
+	defer srv.Close()
+
+	ch := make(chan any)
+
+	go func() {
+		for i := 1; i <= 3; i++ {
+			ch <- rec{ID: i, Name: fmt.Sprintf("n%d", i)}
+		}
+
+		close(ch)
+	}()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Post().NDJSONBodyFromChan(ch).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ct != "application/x-ndjson" {
+		t.Errorf("got content type %q", ct)
+	}
+
+	if want := []rec{{1, "n1"}, {2, "n2"}, {3, "n3"}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBodyFile(t *testing.T) {
+	data := strings.Repeat("file content\n", 1000)
+	path := filepath.Join(t.TempDir(), "upload.txt")
+
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		got []byte
+		cl  int64
+		te  []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		cl = r.ContentLength
+		te = r.TransferEncoding
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Put().BodyFile(path).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != data || cl != int64(len(data)) || len(te) != 0 {
+		t.Errorf("server got %d bytes, content length %d, transfer encoding %v", len(got), cl, te)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Put().BodyFile(path + ".missing").GetBody(context.Background()); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestHMACSign(t *testing.T) {
+	var (
+		sig  string
+		body []byte
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig = r.Header.Get("X-Signature")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	payload := `{"event":"ping"}`
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).Post().
+		Body(io.MultiReader(strings.NewReader(payload))).
+		HMACSign("X-Signature", "secret").
+		GetBody(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(payload))
+
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); sig != want {
+		t.Errorf("got signature %q, want %q", sig, want)
+	}
+
+	if string(body) != payload {
+		t.Errorf("server got body %q", body)
+	}
+}
+
+func TestBufferBodyRedirect(t *testing.T) {
+	var got string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	res, err := New(srv.Client(), nil).URL(srv.URL + "/old").Post().
+		Body(io.MultiReader(strings.NewReader("payload"))).
+		DoRes(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expected redirect not to be followed without BufferBody, got %d", res.StatusCode)
+	}
+
+	_, err = New(srv.Client(), nil).URL(srv.URL + "/old").Post().
+		Body(io.MultiReader(strings.NewReader("payload"))).
+		BufferBody().
+		GetBody(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "payload" {
+		t.Errorf("final handler got %q", got)
+	}
+}
+
+func TestContentMD5(t *testing.T) {
+	payload := "object data"
+	sum := md5.Sum([]byte(payload))
+	want := base64.StdEncoding.EncodeToString(sum[:])
+
+	var got string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Content-MD5")
+
+		if r.URL.Path == "/bad" {
+			w.Header().Set("Content-MD5", "AAAAAAAAAAAAAAAAAAAAAA==")
+		} else {
+			w.Header().Set("Content-MD5", want)
+		}
+
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer srv.Close()
+
+	b, err := New(srv.Client(), nil).URL(srv.URL).Put().
+		Body(strings.NewReader(payload)).
+		WithContentMD5().
+		VerifyContentMD5().
+		GetBody(context.Background())
+
+	if err != nil || string(b) != payload {
+		t.Fatalf("got %q, %v", b, err)
+	}
+
+	if got != want {
+		t.Errorf("server got Content-MD5 %q, want %q", got, want)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL + "/bad").VerifyContentMD5().GetBody(context.Background()); err == nil {
+		t.Error("expected md5 mismatch error")
+	}
+}
+
+func TestJSONArrayBody(t *testing.T) {
+	items := make([]any, 10000)
+
+	for i := range items {
+		items[i] = map[string]int{"n": i}
+	}
+
+	var (
+		got []map[string]int
+		ct  string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct = r.Header.Get("Content-Type")
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Post().JSONArrayBody(items).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ct != "application/json" || len(got) != len(items) || got[9999]["n"] != 9999 {
+		t.Errorf("server got %d items with content type %q", len(got), ct)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Post().JSONArrayBody(nil).GetBody(context.Background()); err != nil || len(got) != 0 {
+		t.Errorf("empty array: got %v, %v", got, err)
+	}
+
+	// the last item is encoded only after the server got the first bytes, so the body is not buffered
+	first := make(chan struct{})
+	items[len(items)-1] = gateItem(first)
+
+	streamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1)
+
+		if _, err := io.ReadFull(r.Body, buf); err != nil || buf[0] != '[' {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		close(first)
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer streamSrv.Close()
+
+	if _, err := New(streamSrv.Client(), nil).URL(streamSrv.URL).Post().JSONArrayBody(items).GetBody(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+type gateItem chan struct{}
+
+func (g gateItem) MarshalJSON() ([]byte, error) {
+	select {
+	case <-g:
+		return []byte("null"), nil
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("body is not sent before encoding finished")
+	}
+}
+
+func TestCompressIfLarger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rd io.Reader = r.Body
+
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			rd = gz
+		}
+
+		b, _ := io.ReadAll(rd)
+		_, _ = fmt.Fprintf(w, "%s %d", r.Header.Get("Content-Encoding"), len(b))
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		size int
+		want string
+	}{
+		{size: 10, want: " 10"},
+		{size: 1000, want: "gzip 1000"},
+	} {
+		b, err := New(srv.Client(), nil).URL(srv.URL).Post().Body(strings.NewReader(strings.Repeat("a", tc.size))).
+			CompressIfLarger(100).GetBody(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tc.want {
+			t.Errorf("size %d: got %q", tc.size, b)
+		}
+	}
+}
+
+type openBreaker struct{}
+
+func (openBreaker) Allow() bool { return false }
+func (openBreaker) Report(bool) {}
+
+func TestBodyFunc(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	calls := 0
+	fn := func() (io.Reader, error) {
+		calls++
+
+		return strings.NewReader("lazy"), nil
+	}
+
+	req := New(srv.Client(), nil).URL(srv.URL).Post().BodyFunc(fn)
+
+	if calls != 0 {
+		t.Fatal("body function is called before sending")
+	}
+
+	b, err := req.GetBody(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "lazy" || calls != 1 {
+		t.Errorf("got %q after %d calls", b, calls)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Post().BodyFunc(fn).CircuitBreaker(openBreaker{}).GetBody(context.Background()); err == nil || calls != 1 {
+		t.Errorf("body function is called with open breaker, %d calls, err %v", calls, err)
+	}
+
+	errBody := errors.New("no body")
+
+	_, err = New(srv.Client(), nil).URL(srv.URL).Post().BodyFunc(func() (io.Reader, error) { return nil, errBody }).GetBody(context.Background())
+	if !errors.Is(err, errBody) {
+		t.Errorf("expected body error, got %v", err)
+	}
+}
+
+func TestProtoBodyFunc(t *testing.T) {
+	var calls int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		b, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%s %x", r.Header.Get("Content-Type"), b)
+	}))
+	defer srv.Close()
+
+	msg := []byte{0x08, 0x96, 0x01}
+
+	b, err := New(srv.Client(), nil).URL(srv.URL).Post().Retry(1).
+		ProtoBodyFunc(func() ([]byte, error) { return msg, nil }).GetBody(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "application/x-protobuf 089601" {
+		t.Errorf("got %q", b)
+	}
+
+	errMarshal := errors.New("marshal error")
+
+	_, err = New(srv.Client(), nil).URL(srv.URL).Post().ProtoBodyFunc(func() ([]byte, error) { return nil, errMarshal }).GetBody(context.Background())
+	if !errors.Is(err, errMarshal) {
+		t.Errorf("expected marshal error, got %v", err)
+	}
+}
+
+func TestBuildClosesBody(t *testing.T) {
+	for name, req := range map[string]*Request{
+		"bad url":     New(http.DefaultClient, nil).URL("://bad"),
+		"bad file":    New(http.DefaultClient, nil).URL("http://example.com").BodyFile(filepath.Join(t.TempDir(), "missing")),
+		"before hook": New(http.DefaultClient, nil).URL("http://example.com").Before(func(*http.Request) error { return errors.New("stop") }),
+	} {
+		body := &trackingBody{Reader: strings.NewReader("data")}
+
+		if _, err := req.Post().BodyFunc(func() (io.Reader, error) { return body, nil }).Build(context.Background()); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+
+		if !body.closed {
+			t.Errorf("%s: body is not closed", name)
+		}
+	}
+
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		_, _ = New(http.DefaultClient, nil).URL("://bad").JSONArrayBody([]any{1, 2}).Build(context.Background())
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	if n := runtime.NumGoroutine(); n > before+2 {
+		t.Errorf("%d goroutines after failed builds, %d before", n, before)
+	}
+}
@@ -0,0 +1,54 @@
+package request
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker decides whether a request may be sent and is told about the outcome of every request it allowed.
+// Transport errors and 5xx responses are reported as failures.
+type CircuitBreaker interface {
+	Allow() bool
+	Report(success bool)
+}
+
+// FailureBreaker opens after threshold consecutive failures and stays open for cooldown.
+// After the cooldown requests are allowed again; the next failure opens it once more.
+type FailureBreaker struct {
+	mx        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+func NewFailureBreaker(threshold int, cooldown time.Duration) *FailureBreaker {
+	return &FailureBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *FailureBreaker) Allow() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return b.failures < b.threshold || time.Now().After(b.openUntil)
+}
+
+func (b *FailureBreaker) Report(success bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if success {
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
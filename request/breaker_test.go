@@ -0,0 +1,68 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cb := NewFailureBreaker(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		_, err := New(srv.Client(), nil).URL(srv.URL).CircuitBreaker(cb).GetBody(context.Background())
+		if err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("attempt %d: unexpected error %v", i, err)
+		}
+	}
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).CircuitBreaker(cb).GetBody(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	if n := hits.Load(); n != 3 {
+		t.Errorf("server got %d requests, want 3", n)
+	}
+}
+
+func TestFailureBreakerCooldown(t *testing.T) {
+	cb := NewFailureBreaker(2, time.Millisecond*50)
+
+	cb.Report(false)
+
+	if !cb.Allow() {
+		t.Fatal("breaker opened before threshold")
+	}
+
+	cb.Report(false)
+
+	if cb.Allow() {
+		t.Fatal("breaker is not open after threshold")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+
+	if !cb.Allow() {
+		t.Fatal("breaker is still open after cooldown")
+	}
+
+	cb.Report(true)
+	cb.Report(false)
+
+	if !cb.Allow() {
+		t.Fatal("success did not reset failure count")
+	}
+}
@@ -0,0 +1,144 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+type CassetteMode int
+
+const (
+	// Record sends requests and appends the interactions to the cassette file.
+	Record CassetteMode = iota
+	// Replay returns recorded responses matched by method and url without sending requests.
+	Replay
+)
+
+var cassetteMx sync.Mutex
+
+type interaction struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Cassette records responses to the file at path or replays them from it, depending on mode.
+// The file has one json interaction per line. In Replay mode the first interaction with the same method and url is used.
+func (r *Request) Cassette(path string, mode CassetteMode) *Request {
+	if mode == Replay {
+		return r.Use(replayCassette(path))
+	}
+
+	return r.Use(recordCassette(path))
+}
+
+func recordCassette(path string) Middleware {
+	return func(next RoundFunc) RoundFunc {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			res, err := next(ctx, req)
+			if err != nil {
+				return res, err
+			}
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+
+			if err != nil {
+				return nil, err
+			}
+
+			res.Body = io.NopCloser(bytes.NewReader(b))
+
+			line, err := json.Marshal(interaction{Method: req.Method, URL: req.URL.String(), Status: res.StatusCode, Header: res.Header, Body: b})
+			if err != nil {
+				return nil, err
+			}
+
+			cassetteMx.Lock()
+			defer cassetteMx.Unlock()
+
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = f.Write(append(line, '\n'))
+			if err1 := f.Close(); err == nil {
+				err = err1
+			}
+
+			return res, err
+		}
+	}
+}
+
+func replayCassette(path string) Middleware {
+	return func(_ RoundFunc) RoundFunc {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+
+			it, err := findInteraction(path, req.Method, req.URL.String())
+			if err != nil {
+				return nil, err
+			}
+
+			return &http.Response{
+				Status:        fmt.Sprintf("%d %s", it.Status, http.StatusText(it.Status)),
+				StatusCode:    it.Status,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        it.Header,
+				Body:          io.NopCloser(bytes.NewReader(it.Body)),
+				ContentLength: int64(len(it.Body)),
+				Request:       req,
+			}, nil
+		}
+	}
+}
+
+func findInteraction(path, method, url string) (*interaction, error) {
+	cassetteMx.Lock()
+	defer cassetteMx.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+
+	for {
+		var it interaction
+
+		if err := dec.Decode(&it); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("no recorded interaction for %s %s", method, url)
+			}
+
+			return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+		}
+
+		if it.Method == method && it.URL == url {
+			if it.Header == nil {
+				it.Header = make(http.Header)
+			}
+
+			return &it, nil
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassette(t *testing.T) {
+	calls := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("X-Path", r.URL.Path)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	for _, p := range []string{"/a", "/b"} {
+		b, err := New(srv.Client(), nil).URL(srv.URL+p).Cassette(path, Record).GetBody(context.Background())
+		if err != nil || string(b) != "GET "+p {
+			t.Fatalf("got %q, %v", b, err)
+		}
+	}
+
+	_, _ = New(srv.Client(), nil).URL(srv.URL+"/missing").Cassette(path, Record).GetBody(context.Background())
+
+	srv.Close()
+
+	for _, p := range []string{"/b", "/a"} {
+		req := New(srv.Client(), nil).URL(srv.URL+p).Cassette(path, Replay)
+
+		b, err := req.GetBody(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != "GET "+p || req.LastHeaders().Get("X-Path") != p {
+			t.Errorf("got %q, headers %v", b, req.LastHeaders())
+		}
+	}
+
+	_, err := New(srv.Client(), nil).URL(srv.URL+"/missing").Cassette(path, Replay).GetBody(context.Background())
+
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusNotFound {
+		t.Errorf("expected recorded 404, got %v", err)
+	}
+
+	_, err = New(srv.Client(), nil).URL(srv.URL+"/a").Post().Cassette(path, Replay).GetBody(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no recorded interaction") {
+		t.Errorf("expected no interaction error, got %v", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("server got %d calls", calls)
+	}
+}
@@ -0,0 +1,63 @@
+package request
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Client makes requests to one service. Settings methods return a changed copy, so a Client is safe for concurrent use.
+type Client struct {
+	client  *http.Client
+	logger  *slog.Logger
+	baseURL string
+	tmpl    *Template
+}
+
+func NewClient(c *http.Client, logger *slog.Logger, baseURL string) *Client {
+	return &Client{client: c, logger: logger, baseURL: strings.TrimSuffix(baseURL, "/"), tmpl: NewTemplate()}
+}
+
+func (c *Client) Token(token string) *Client {
+	return c.with(c.tmpl.Token(token))
+}
+
+func (c *Client) Auth(login, passw string) *Client {
+	return c.with(c.tmpl.Auth(login, passw))
+}
+
+func (c *Client) AddHeader(k, v string) *Client {
+	return c.with(c.tmpl.AddHeader(k, v))
+}
+
+// New returns a request to path relative to the client base url.
+func (c *Client) New(method, path string) *Request {
+	return c.tmpl.New(c.client, c.logger).Method(method).URL(c.baseURL + "/" + strings.TrimPrefix(path, "/"))
+}
+
+func (c *Client) Get(path string) *Request {
+	return c.New(http.MethodGet, path)
+}
+
+func (c *Client) Post(path string) *Request {
+	return c.New(http.MethodPost, path)
+}
+
+func (c *Client) Put(path string) *Request {
+	return c.New(http.MethodPut, path)
+}
+
+func (c *Client) Patch(path string) *Request {
+	return c.New(http.MethodPatch, path)
+}
+
+func (c *Client) Delete(path string) *Request {
+	return c.New(http.MethodDelete, path)
+}
+
+func (c *Client) with(t *Template) *Client {
+	n := *c
+	n.tmpl = t
+
+	return &n
+}
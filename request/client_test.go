@@ -0,0 +1,46 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"method": r.Method, "path": r.URL.Path})
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), nil, srv.URL+"/api/").Token("t1")
+
+	var got map[string]string
+
+	if err := c.Get("/users").GetJSON(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["method"] != http.MethodGet || got["path"] != "/api/users" {
+		t.Errorf("got %v", got)
+	}
+
+	if err := c.Delete("users/1").GetJSON(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["method"] != http.MethodDelete || got["path"] != "/api/users/1" {
+		t.Errorf("got %v", got)
+	}
+
+	if err := NewClient(srv.Client(), nil, srv.URL).Get("/").GetJSON(context.Background(), &got); err == nil {
+		t.Error("expected error without token")
+	}
+}
@@ -0,0 +1,162 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// FromCurl makes a request from curl command line. Supported options are -X/--request, -H/--header,
+// -d/--data/--data-raw (several are joined with '&' as curl does) and -u/--user. Other options are an error.
+// Single and double quotes and backslash escapes are handled like a shell does.
+func FromCurl(curl string, client *http.Client, logger *slog.Logger) (*Request, error) {
+	args, err := splitArgs(curl)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+
+	r := New(client, logger)
+
+	var (
+		method string
+		data   []string
+	)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") {
+			if r.url != "" {
+				return nil, fmt.Errorf("more than one url: %s and %s", r.url, arg)
+			}
+
+			r.URL(arg)
+
+			continue
+		}
+
+		name, value := arg, ""
+		hasValue := false
+
+		if len(arg) > 2 && arg[1] != '-' {
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+
+		switch name {
+		case "-X", "--request", "-H", "--header", "-d", "--data", "--data-raw", "-u", "--user":
+		default:
+			return nil, fmt.Errorf("unsupported curl option %s", arg)
+		}
+
+		if !hasValue {
+			if i++; i >= len(args) {
+				return nil, fmt.Errorf("no value for %s", arg)
+			}
+
+			value = args[i]
+		}
+
+		switch name {
+		case "-X", "--request":
+			method = value
+		case "-H", "--header":
+			k, v, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid header %q", value)
+			}
+
+			r.AddHeader(strings.TrimSpace(k), strings.TrimSpace(v))
+		case "-d", "--data", "--data-raw":
+			data = append(data, value)
+		case "-u", "--user":
+			r.AuthUserInfo(value)
+		}
+	}
+
+	if r.url == "" {
+		return nil, errors.New("no url in curl command")
+	}
+
+	if len(data) > 0 {
+		r.Post().Body(strings.NewReader(strings.Join(data, "&")))
+
+		if !hasHeader(r.headers, "Content-Type") {
+			r.AddHeader("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+
+	if method != "" {
+		r.Method(method)
+	}
+
+	return r, nil
+}
+
+func hasHeader(headers map[string]string, k string) bool {
+	for h := range headers {
+		if strings.EqualFold(h, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitArgs splits command line into arguments.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		cur   strings.Builder
+		inArg bool
+		quote rune
+		esc   bool
+	)
+
+	for _, c := range s {
+		switch {
+		case esc:
+			esc = false
+
+			if c != '\n' {
+				cur.WriteRune(c)
+				inArg = true
+			}
+		case c == '\\' && quote != '\'':
+			esc = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || esc {
+		return nil, errors.New("unterminated quote or escape in curl command")
+	}
+
+	if inArg {
+		args = append(args, cur.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,66 @@
+package request
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFromCurl(t *testing.T) {
+	r, err := FromCurl(`curl -X PUT 'https://example.com/api/items?id=1' \
+		-H "Content-Type: application/json" -H 'X-Token:abc' \
+		--data '{"name": "it'\''s"}' -u user:pass`, http.DefaultClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.method != http.MethodPut || r.url != "https://example.com/api/items?id=1" {
+		t.Errorf("got %s %s", r.method, r.url)
+	}
+
+	if r.headers["Content-Type"] != "application/json" || r.headers["X-Token"] != "abc" || len(r.headers) != 2 {
+		t.Errorf("got headers %v", r.headers)
+	}
+
+	if r.login != "user" || r.passw != "pass" {
+		t.Errorf("got auth %s:%s", r.login, r.passw)
+	}
+
+	if b, _ := io.ReadAll(r.body); string(b) != `{"name": "it's"}` {
+		t.Errorf("got body %q", b)
+	}
+
+	r, err = FromCurl(`curl -d a=1 -d "b=2 3" http://localhost/form`, http.DefaultClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.method != http.MethodPost || r.headers["Content-Type"] != "application/x-www-form-urlencoded" {
+		t.Errorf("got %s %v", r.method, r.headers)
+	}
+
+	if b, _ := io.ReadAll(r.body); string(b) != "a=1&b=2 3" {
+		t.Errorf("got body %q", b)
+	}
+
+	r, err = FromCurl(`-XDELETE http://localhost/items/1`, http.DefaultClient, nil)
+	if err != nil || r.method != http.MethodDelete || r.body != nil {
+		t.Errorf("got %v, %v", r, err)
+	}
+
+	for _, bad := range []string{
+		`curl -k https://example.com`,
+		`curl -H`,
+		`curl -X POST`,
+		`curl 'https://example.com`,
+		`curl http://a http://b`,
+		`curl -H nocolon http://a`,
+	} {
+		if _, err := FromCurl(bad, http.DefaultClient, nil); err == nil {
+			t.Errorf("expected error for %s", bad)
+		} else if strings.Contains(bad, "-k") && !strings.Contains(err.Error(), "-k") {
+			t.Errorf("error doesn't name the option: %v", err)
+		}
+	}
+}
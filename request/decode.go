@@ -0,0 +1,75 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+var decoders = struct {
+	sync.RWMutex
+	m map[string]func(io.Reader, any) error
+}{
+	m: map[string]func(io.Reader, any) error{
+		"application/json": func(rd io.Reader, obj any) error {
+			return json.NewDecoder(rd).Decode(obj)
+		},
+		"application/xml": func(rd io.Reader, obj any) error {
+			return xml.NewDecoder(rd).Decode(obj)
+		},
+		"text/xml": func(rd io.Reader, obj any) error {
+			return xml.NewDecoder(rd).Decode(obj)
+		},
+	},
+}
+
+// RegisterDecoder sets decoder used by Decode for responses with mediaType content type.
+func RegisterDecoder(mediaType string, fn func(io.Reader, any) error) {
+	decoders.Lock()
+	defer decoders.Unlock()
+
+	decoders.m[strings.ToLower(mediaType)] = fn
+}
+
+func decoderFor(mediaType string) func(io.Reader, any) error {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	if fn, ok := decoders.m[mediaType]; ok {
+		return fn
+	}
+
+	// structured syntax suffix, like application/problem+json
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		return decoders.m["application/"+mediaType[i+1:]]
+	}
+
+	return nil
+}
+
+// Decode decodes response body into obj with the decoder registered for the response content type.
+func (r *Request) Decode(ctx context.Context, obj any) error {
+	res, err := r.DoRes(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	mt, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", res.Header.Get("Content-Type"), err)
+	}
+
+	fn := decoderFor(mt)
+	if fn == nil {
+		return fmt.Errorf("no decoder for content type %s", mt)
+	}
+
+	return fn(res.Body, obj)
+}
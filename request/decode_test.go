@@ -0,0 +1,70 @@
+package request
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+			_, _ = w.Write([]byte(`{"name":"j"}`))
+		case "/xml":
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write([]byte(`<v><name>x</name></v>`))
+		case "/custom":
+			w.Header().Set("Content-Type", "application/x-test-kv")
+			_, _ = w.Write([]byte(`name=c`))
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}))
+	defer srv.Close()
+
+	RegisterDecoder("application/x-test-kv", func(rd io.Reader, obj any) error {
+		b, err := io.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+
+		m := obj.(*map[string]string)
+		k, v, _ := strings.Cut(string(b), "=")
+		*m = map[string]string{k: v}
+
+		return nil
+	})
+
+	var v struct {
+		Name string `json:"name" xml:"name"`
+	}
+
+	for _, p := range []string{"json", "xml"} {
+		if err := New(srv.Client(), nil).URL(srv.URL+"/"+p).Decode(context.Background(), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		if v.Name != p[:1] {
+			t.Errorf("%s: got %+v", p, v)
+		}
+	}
+
+	var m map[string]string
+
+	if err := New(srv.Client(), nil).URL(srv.URL+"/custom").Decode(context.Background(), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m["name"] != "c" {
+		t.Errorf("custom decoder was not used, got %v", m)
+	}
+
+	if err := New(srv.Client(), nil).URL(srv.URL+"/other").Decode(context.Background(), &m); err == nil {
+		t.Error("expected error for unknown content type")
+	}
+}
@@ -0,0 +1,67 @@
+package request
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DownloadVerify saves the response body to path and checks its SHA-256 against expectedSHA256 hex string.
+// The body is written to a temporary file in the same directory that replaces path only when the checksum matches,
+// so on any error, including checksum mismatch, an existing file at path is kept.
+func (r *Request) DownloadVerify(ctx context.Context, path, expectedSHA256 string) error {
+	body, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(f, h), body)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+
+	if err == nil {
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, expectedSHA256) {
+			err = fmt.Errorf("sha256 mismatch for %s: got %s, expected %s", path, got, expectedSHA256)
+		}
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), fileMode(path))
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	return nil
+}
+
+// fileMode returns the mode of the existing file at path, temporary files are created with 0600.
+func fileMode(path string) os.FileMode {
+	if fi, err := os.Stat(path); err == nil {
+		return fi.Mode().Perm()
+	}
+
+	return 0o644
+}
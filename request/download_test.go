@@ -0,0 +1,58 @@
+package request
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("file content"))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256([]byte("file content"))
+	good := hex.EncodeToString(sum[:])
+	path := filepath.Join(t.TempDir(), "file")
+
+	if err := New(srv.Client(), nil).URL(srv.URL).DownloadVerify(context.Background(), path, strings.ToUpper(good)); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(path); err != nil || string(b) != "file content" {
+		t.Errorf("got %q, %v", b, err)
+	}
+
+	bad := strings.Repeat("0", 64)
+
+	err := New(srv.Client(), nil).URL(srv.URL).DownloadVerify(context.Background(), path, bad)
+	if err == nil || !strings.Contains(err.Error(), good) || !strings.Contains(err.Error(), bad) {
+		t.Errorf("expected mismatch error with both hashes, got %v", err)
+	}
+
+	if b, err := os.ReadFile(path); err != nil || string(b) != "file content" {
+		t.Errorf("existing file is changed: %q, %v", b, err)
+	}
+
+	missing := filepath.Join(filepath.Dir(path), "missing")
+
+	if err := New(srv.Client(), nil).URL(srv.URL).DownloadVerify(context.Background(), missing, bad); err == nil {
+		t.Error("expected mismatch error")
+	}
+
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file is created: %v", err)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files are left: %v", entries)
+	}
+}
@@ -0,0 +1,57 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const errorBodyLimit = 64 << 10
+
+// StatusError is returned for responses with 4xx and 5xx status codes.
+// Body keeps up to 64 KiB of the response body.
+type StatusError struct {
+	Code   int
+	Status string
+	Body   []byte
+}
+
+func (e *StatusError) Error() string {
+	return "status is " + e.Status
+}
+
+// DecodeBody decodes captured JSON error body into out.
+func (e *StatusError) DecodeBody(out any) error {
+	if len(e.Body) == 0 {
+		return errors.New("error body is empty")
+	}
+
+	if err := json.Unmarshal(e.Body, out); err != nil {
+		return fmt.Errorf("error body is not valid json: %w", err)
+	}
+
+	return nil
+}
+
+// newStatusError reads the error body and puts the captured copy back to res.Body, so callers still can read it.
+// The rest of the body, up to the same limit, is drained before closing to let the connection be reused.
+func newStatusError(res *http.Response) *StatusError {
+	e := &StatusError{Code: res.StatusCode, Status: res.Status}
+
+	if res.Body != nil {
+		e.Body, _ = io.ReadAll(io.LimitReader(res.Body, errorBodyLimit))
+		drainBody(res.Body)
+		res.Body = io.NopCloser(bytes.NewReader(e.Body))
+	}
+
+	return e
+}
+
+// drainBody reads up to errorBodyLimit of the body before closing it, so the connection can be reused.
+func drainBody(body io.ReadCloser) {
+	_, _ = io.CopyN(io.Discard, body, errorBodyLimit)
+	body.Close()
+}
@@ -0,0 +1,124 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusErrorDecodeBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"code":"invalid","message":"name is required"}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).Post().GetBody(context.Background())
+
+	var se *StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected StatusError, got %v", err)
+	}
+
+	if se.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got code %d", se.Code)
+	}
+
+	var details struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+
+	if err := se.DecodeBody(&details); err != nil {
+		t.Fatal(err)
+	}
+
+	if details.Code != "invalid" || details.Message != "name is required" {
+		t.Errorf("got %+v", details)
+	}
+}
+
+func TestStatusErrorDecodeBodyInvalid(t *testing.T) {
+	var out map[string]any
+
+	if err := (&StatusError{}).DecodeBody(&out); err == nil {
+		t.Error("expected error for empty body")
+	}
+
+	if err := (&StatusError{Body: []byte("<html>")}).DecodeBody(&out); err == nil {
+		t.Error("expected error for non-json body")
+	}
+}
+
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+
+	return nil
+}
+
+type staticTransport struct {
+	status int
+	body   *trackingBody
+}
+
+func (t staticTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: t.status,
+		Status:     http.StatusText(t.status),
+		Header:     make(http.Header),
+		Body:       t.body,
+		Request:    req,
+	}, nil
+}
+
+func TestStatusErrorClosesBody(t *testing.T) {
+	body := &trackingBody{Reader: strings.NewReader(strings.Repeat("e", errorBodyLimit+100))}
+	c := &http.Client{Transport: staticTransport{status: http.StatusInternalServerError, body: body}}
+
+	res, err := New(c, nil).URL("http://example.com").DoRes(context.Background())
+
+	var se *StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected StatusError, got %v", err)
+	}
+
+	if !body.closed {
+		t.Error("response body was not closed")
+	}
+
+	if n, _ := body.Read(make([]byte, 1)); n != 0 {
+		t.Error("response body was not drained")
+	}
+
+	if b, _ := io.ReadAll(res.Body); len(b) != errorBodyLimit {
+		t.Errorf("captured %d bytes", len(b))
+	}
+}
+
+func TestRequireHeaderDrainsBody(t *testing.T) {
+	for _, fn := range []func(*Request) *Request{
+		func(r *Request) *Request { return r.RequireHeader("X-Verified", "") },
+		func(r *Request) *Request { return r.AcceptContentTypes("application/json") },
+	} {
+		body := &trackingBody{Reader: strings.NewReader("<html>portal</html>")}
+		c := &http.Client{Transport: staticTransport{status: http.StatusOK, body: body}}
+
+		if _, err := fn(New(c, nil).URL("http://example.com")).DoRes(context.Background()); err == nil {
+			t.Error("expected error")
+		}
+
+		if n, _ := body.Read(make([]byte, 1)); n != 0 || !body.closed {
+			t.Errorf("response body was not drained and closed")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+var rpcID atomic.Int64
+
+// RPCError is the error object of JSON-RPC 2.0 response.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPC posts JSON-RPC 2.0 call of method with params and decodes the response result into result.
+// Nil params are not sent.
+// Error object of the response is returned as *RPCError. Method, body and headers of the Request are restored after the call.
+func (r *Request) JSONRPC(ctx context.Context, method string, params any, result any) error {
+	id := rpcID.Add(1)
+
+	call := map[string]any{"jsonrpc": "2.0", "id": id, "method": method}
+
+	// params member may be omitted, but must not be null
+	if params != nil {
+		call["params"] = params
+	}
+
+	b, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+
+	defer r.keep()()
+
+	r.method = http.MethodPost
+	r.body = bytes.NewReader(b)
+	r.AddHeader("Content-Type", "application/json")
+
+	var res struct {
+		ID     int64           `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+
+	if err := r.GetJSON(ctx, &res); err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.ID != id {
+		return fmt.Errorf("rpc response id is %d, want %d", res.ID, id)
+	}
+
+	if result == nil || len(res.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(res.Result, result)
+}
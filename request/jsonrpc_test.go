@@ -0,0 +1,71 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONRPC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Version string          `json:"jsonrpc"`
+			ID      int64           `json:"id"`
+			Method  string          `json:"method"`
+			Params  json.RawMessage `json:"params"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version != "2.0" {
+			t.Errorf("bad request %v %v", req, err)
+		}
+
+		var params []int
+
+		if req.Params != nil {
+			_ = json.Unmarshal(req.Params, &params)
+		} else if req.Method == "sum" {
+			t.Error("no params")
+		}
+
+		if string(req.Params) == "null" {
+			t.Error("params is null")
+		}
+
+		res := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+
+		if req.Method == "sum" {
+			res["result"] = params[0] + params[1]
+		} else {
+			res["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	var sum int
+
+	req := New(srv.Client(), nil).URL(srv.URL)
+
+	if err := req.JSONRPC(context.Background(), "sum", []int{2, 3}, &sum); err != nil {
+		t.Fatal(err)
+	}
+
+	if sum != 5 {
+		t.Errorf("got %d", sum)
+	}
+
+	if req.method != http.MethodGet || req.body != nil || len(req.headers) != 0 {
+		t.Errorf("request is changed: %s %v %v", req.method, req.body, req.headers)
+	}
+
+	err := New(srv.Client(), nil).URL(srv.URL).JSONRPC(context.Background(), "nope", nil, &sum)
+
+	var re *RPCError
+	if !errors.As(err, &re) || re.Code != -32601 || re.Message != "method not found" {
+		t.Errorf("expected rpc error, got %v", err)
+	}
+}
@@ -1,28 +1,126 @@
 package request
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	defaultTimeout atomic.Int64
+	stripUserAgent atomic.Bool
+)
+
+// SetStripUserAgent sets if requests strip User-Agent added by the transport, false by default.
+// KeepUserAgent and explicit User-Agent header still work per request.
+func SetStripUserAgent(strip bool) {
+	stripUserAgent.Store(strip)
+}
+
+// SetDefaultTimeout sets timeout for requests that have no own timeout and are sent with a context without deadline.
+// Zero means no default timeout.
+func SetDefaultTimeout(d time.Duration) {
+	defaultTimeout.Store(int64(d))
+}
+
 type Request struct {
-	client  *http.Client
-	url     string
-	method  string
-	token   string
-	login   string
-	passw   string
-	body    io.Reader
-	headers map[string]string
-	args    map[string]string
-	cookies []*http.Cookie
-	logger  *slog.Logger
+	client   *http.Client
+	url      string
+	method   string
+	token    string
+	login    string
+	passw    string
+	body     io.Reader
+	bodyFn   func() (io.Reader, error)
+	headers  map[string]string
+	multi    map[string][]string
+	args     map[string]string
+	cookies  []*http.Cookie
+	logger   *slog.Logger
+	breaker  CircuitBreaker
+	expect   bool
+	tr       *http.Transport
+	flight   *SingleFlightGroup
+	hdrFn    func(h http.Header)
+	keepUA   bool
+	err      error
+	bodyErr  error
+	read     atomic.Int64
+	backup   []string
+	rawArgs  bool
+	dlName   string
+	dlFmt    func(time.Duration) string
+	strict   bool
+	rawHdr   map[string]string
+	mws      []Middleware
+	file     string
+	retries  int
+	backoff  BackoffStrategy
+	sign     *hmacSign
+	buffer   bool
+	sample   *float64
+	before   func(*http.Request) error
+	redir    func(req *http.Request, via []*http.Request) error
+	timeout  time.Duration
+	md5      bool
+	checkMD5 bool
+	idemOnly bool
+	scheme   string
+	maxLine  int
+	refresh  func(context.Context) (string, error)
+	idle     time.Duration
+	lastHdr  atomic.Pointer[http.Header]
+	budget   time.Duration
+	ordered  [][2]string
+	gzip     bool
+	chunked  bool
+	logBody  int
+	noStatus bool
+	compress *int
+	trace    bool
+	csvComma rune
+	csvSkip  bool
+	argFns   []argFunc
+	required map[string]string
+	tee      io.Writer
+	balancer *Balancer
+	length   *int64
+	decoder  func(io.Reader, any) error
+	sem      chan struct{}
+	corrKey  any
+	corrHdr  string
+	ctypes   []string
+	onRetry  func(attempt int, status int, err error, nextDelay time.Duration)
+	readDL   time.Duration
+	redactH  []string
+	redactA  []string
 }
 
+// RoundFunc sends the request and returns the response.
+type RoundFunc func(ctx context.Context, req *http.Request) (*http.Response, error)
+
+// Middleware wraps sending of the request.
+type Middleware func(next RoundFunc) RoundFunc
+
 func New(c *http.Client, logger *slog.Logger) *Request {
 	l := logger
 
@@ -33,6 +131,15 @@ func New(c *http.Client, logger *slog.Logger) *Request {
 	return &Request{client: c, method: "GET", logger: l}
 }
 
+// WithLogger sets logger for this request. Nil logger is ignored.
+func (r *Request) WithLogger(l *slog.Logger) *Request {
+	if l != nil {
+		r.logger = l
+	}
+
+	return r
+}
+
 func (r *Request) URL(url string) *Request {
 	r.url = url
 
@@ -57,8 +164,40 @@ func (r *Request) Post() *Request {
 	return r
 }
 
+// Timeout limits the whole request, including reading of the response body. A context with an earlier deadline still wins.
+func (r *Request) Timeout(d time.Duration) *Request {
+	r.timeout = d
+
+	return r
+}
+
+// Fallback sets urls to try in order when the request fails with transport error or 5xx status.
+// Request body must be replayable, e.g. bytes.Reader or strings.Reader, otherwise fallbacks are not tried.
+func (r *Request) Fallback(urls ...string) *Request {
+	r.backup = urls
+
+	return r
+}
+
 func (r *Request) Token(token string) *Request {
 	r.token = token
+	r.scheme = ""
+
+	return r
+}
+
+// RefreshOn401 makes the request to get a new token with refresh and resend once when the server responds with 401.
+// Request body must be replayable.
+func (r *Request) RefreshOn401(refresh func(context.Context) (string, error)) *Request {
+	r.refresh = refresh
+
+	return r
+}
+
+// TokenScheme sets "Authorization: <scheme> <token>" header. Token is the same with Bearer scheme.
+func (r *Request) TokenScheme(scheme, token string) *Request {
+	r.token = token
+	r.scheme = scheme
 
 	return r
 }
@@ -70,6 +209,14 @@ func (r *Request) Auth(login, passw string) *Request {
 	return r
 }
 
+// AuthUserInfo sets basic auth from "user:pass" string. String without colon is a user name with empty password,
+// empty string means no auth.
+func (r *Request) AuthUserInfo(userinfo string) *Request {
+	login, passw, _ := strings.Cut(userinfo, ":")
+
+	return r.Auth(login, passw)
+}
+
 func (r *Request) Headers(headers map[string]string) *Request {
 	r.headers = headers
 
@@ -86,134 +233,1645 @@ func (r *Request) AddHeader(k, v string) *Request {
 	return r
 }
 
+func (r *Request) Referer(url string) *Request {
+	return r.AddHeader("Referer", url)
+}
+
+// IfMatch sets If-Match header, the server responds with 412 if the resource etag doesn't match.
+// The conflict is returned as *StatusError with Code http.StatusPreconditionFailed.
+func (r *Request) IfMatch(etag string) *Request {
+	return r.AddHeader("If-Match", etag)
+}
+
+// AcceptGzip asks for gzip encoded response and decodes it, the response is returned without Content-Encoding.
+func (r *Request) AcceptGzip() *Request {
+	r.gzip = true
+
+	return r.AddHeader("Accept-Encoding", "gzip")
+}
+
+// Range requests bytes from start to end inclusive. Negative end means up to the end of the content.
+func (r *Request) Range(start, end int64) *Request {
+	if end < 0 {
+		return r.AddHeader("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	return r.AddHeader("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+}
+
+func (r *Request) AddHeaderMulti(k string, values ...string) *Request {
+	if r.multi == nil {
+		r.multi = make(map[string][]string)
+	}
+
+	r.multi[k] = append(r.multi[k], values...)
+
+	return r
+}
+
+// RawHeader sets header with the key sent exactly as given, without canonicalization.
+// It works for HTTP/1.x only, HTTP/2 always sends lowercase keys.
+func (r *Request) RawHeader(k, v string) *Request {
+	if r.rawHdr == nil {
+		r.rawHdr = make(map[string]string)
+	}
+
+	r.rawHdr[k] = v
+
+	return r
+}
+
+// CorrelationFromContext sets header to the string value stored in the request context under ctxKey, if there is one.
+func (r *Request) CorrelationFromContext(ctxKey any, header string) *Request {
+	r.corrKey = ctxKey
+	r.corrHdr = header
+
+	return r
+}
+
+// HeaderTransform sets a function called with the request headers after all other headers are set.
+func (r *Request) HeaderTransform(fn func(h http.Header)) *Request {
+	r.hdrFn = fn
+
+	return r
+}
+
+// PropagateDeadline sends time left until the context deadline in milliseconds as headerName header.
+// Nothing is sent if the context has no deadline.
+func (r *Request) PropagateDeadline(headerName string) *Request {
+	return r.PropagateDeadlineFunc(headerName, func(d time.Duration) string {
+		return strconv.FormatInt(d.Milliseconds(), 10)
+	})
+}
+
+// PropagateDeadlineFunc is like PropagateDeadline, but the header value is formatted with format.
+func (r *Request) PropagateDeadlineFunc(headerName string, format func(time.Duration) string) *Request {
+	r.dlName = headerName
+	r.dlFmt = format
+
+	return r
+}
+
+// Before sets a hook called with the built request right before sending. Returned error aborts the request.
+func (r *Request) Before(fn func(*http.Request) error) *Request {
+	r.before = fn
+
+	return r
+}
+
+// KeepUserAgent stops the request from stripping User-Agent when it is enabled with SetStripUserAgent,
+// so the one added by the transport is sent.
+func (r *Request) KeepUserAgent() *Request {
+	r.keepUA = true
+
+	return r
+}
+
 func (r *Request) AddCookie(c *http.Cookie) *Request {
 	r.cookies = append(r.cookies, c)
 
 	return r
 }
 
+// CookieHeader adds cookies from "a=1; b=2" Cookie header value. Malformed pairs are skipped.
+func (r *Request) CookieHeader(raw string) *Request {
+	for _, pair := range strings.Split(raw, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || strings.ContainsAny(name, " \t\",") {
+			continue
+		}
+
+		r.cookies = append(r.cookies, &http.Cookie{Name: name, Value: strings.Trim(value, "\"")})
+	}
+
+	return r
+}
+
 func (r *Request) Args(args map[string]string) *Request {
 	r.args = args
 
 	return r
 }
 
+// OrderedArgs adds query args in the given order, after args set with Args. They are escaped unless RawArgs is set.
+func (r *Request) OrderedArgs(pairs ...[2]string) *Request {
+	r.ordered = append(r.ordered, pairs...)
+
+	return r
+}
+
+// ArgFunc adds query arg with the value returned by fn when the request is sent, e.g. for rotated api keys.
+func (r *Request) ArgFunc(key string, fn func() string) *Request {
+	r.argFns = append(r.argFns, argFunc{key: key, fn: fn})
+
+	return r
+}
+
+type argFunc struct {
+	key string
+	fn  func() string
+}
+
+// RawArgs makes args to be appended to the query as is, without escaping.
+// Caller is responsible for encoding keys and values; unescaped '&', '#' or spaces break the url.
+func (r *Request) RawArgs() *Request {
+	r.rawArgs = true
+
+	return r
+}
+
 func (r *Request) Body(body io.Reader) *Request {
 	r.body = body
 
 	return r
 }
 
-func (r *Request) DoRes(ctx context.Context) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, r.method, r.url, r.body)
-	if err != nil {
-		return nil, err
-	}
+// ContentLength sets Content-Length of the request, the body must have exactly n bytes.
+// It is useful for bodies of known size read from non-seekable readers.
+func (r *Request) ContentLength(n int64) *Request {
+	r.length = &n
+
+	return r
+}
 
-	req.Header.Del("User-Agent")
+// ChunkedBody sets body sent with chunked transfer encoding, every read from reader is sent to the server as it comes.
+// The body is not buffered, so the request can't be replayed by Retry, Fallback or RefreshOn401.
+func (r *Request) ChunkedBody(reader io.Reader) *Request {
+	r.body = reader
+	r.chunked = true
 
-	if len(r.headers) > 0 {
-		for k, v := range r.headers {
-			req.Header.Set(k, v)
-		}
+	return r
+}
+
+func (r *Request) CircuitBreaker(cb CircuitBreaker) *Request {
+	r.breaker = cb
+
+	return r
+}
+
+// Expect100Continue sends "Expect: 100-continue" so the server can reject the request before the body is sent.
+// If the client *http.Transport does not wait for the 100 response, a copy of it with a one second wait is used for this request.
+func (r *Request) Expect100Continue() *Request {
+	r.expect = true
+
+	if t, ok := r.baseTransport().(*http.Transport); ok && t.ExpectContinueTimeout <= 0 {
+		r.transport().ExpectContinueTimeout = time.Second
 	}
 
-	if r.token != "" {
-		req.Header.Set("Authorization", "Bearer "+r.token)
-	} else {
-		if r.login != "" {
-			req.SetBasicAuth(r.login, r.passw)
+	return r
+}
+
+// MaxRedirects follows up to n redirects and then returns the last redirect response without error.
+func (r *Request) MaxRedirects(n int) *Request {
+	r.redir = func(_ *http.Request, via []*http.Request) error {
+		if len(via) > n {
+			return http.ErrUseLastResponse
 		}
+
+		return nil
 	}
 
-	if len(r.args) > 0 {
-		q := req.URL.Query()
+	return r
+}
 
-		for k, v := range r.args {
-			q.Add(k, v)
-		}
+// DialContext sets the dialer used for connections of this request, e.g. to connect through a bastion host.
+// The client transport must be *http.Transport, otherwise the request fails.
+func (r *Request) DialContext(fn func(ctx context.Context, network, addr string) (net.Conn, error)) *Request {
+	r.transport().DialContext = fn
 
-		req.URL.RawQuery = q.Encode()
+	return r
+}
+
+// transport returns a transport private to this request, cloned from the client one on first use.
+// Its idle connections are closed when the response body is closed.
+// Transports other than *http.Transport can't be cloned, the request fails then instead of dropping the client one.
+func (r *Request) transport() *http.Transport {
+	if r.tr != nil {
+		return r.tr
 	}
 
-	for _, c := range r.cookies {
-		req.AddCookie(c)
+	t, ok := r.baseTransport().(*http.Transport)
+	if !ok {
+		r.err = fmt.Errorf("transport %T can't be cloned", r.baseTransport())
+
+		// settings go to a throwaway transport, the request is not sent
+		return new(http.Transport)
 	}
 
-	res, err := r.client.Do(req)
-	if err != nil {
-		r.logger.Info(fmt.Sprintf("%s %s - error %s", r.method, req.URL, err.Error()))
+	r.tr = t.Clone()
 
-		return res, err
+	return r.tr
+}
+
+func (r *Request) baseTransport() http.RoundTripper {
+	if r.client.Transport != nil {
+		return r.client.Transport
 	}
 
-	if res.StatusCode > 399 {
-		r.logger.Warn(fmt.Sprintf("%s %s - %d", r.method, req.URL, res.StatusCode))
+	return http.DefaultTransport
+}
 
-		return res, fmt.Errorf("status is %s", res.Status)
+func (r *Request) httpClient() *http.Client {
+	if r.tr == nil && r.redir == nil {
+		return r.client
 	}
 
-	r.logger.Debug(fmt.Sprintf("%s %s - %d", r.method, req.URL, res.StatusCode))
+	c := *r.client
 
-	return res, nil
+	if r.tr != nil {
+		c.Transport = r.tr
+	}
+
+	if r.redir != nil {
+		c.CheckRedirect = r.redir
+	}
+
+	return &c
 }
 
-func (r *Request) Do(ctx context.Context) (io.ReadCloser, error) {
-	res, err := r.DoRes(ctx)
+// SingleFlight makes concurrent GET and HEAD requests with the same url and headers, including auth and cookies,
+// share one call to the server. Every caller gets its own copy of the response with the fully read body.
+// If the context of the caller making the shared call is done, waiting callers send the request again.
+// Other methods are sent as usual.
+func (r *Request) SingleFlight(group *SingleFlightGroup) *Request {
+	r.flight = group
+
+	return r
+}
+
+// TeeResponse writes the response body to w as it is read. Error bodies are written as far as they are read,
+// up to 64 KiB captured into StatusError. w is not closed.
+func (r *Request) TeeResponse(w io.Writer) *Request {
+	r.tee = w
+
+	return r
+}
+
+// LogBodies logs request headers and up to maxBytes of request and response bodies at debug level.
+// Bodies are not buffered, the start of a streamed request body is logged as the transport reads it.
+// Authorization, Proxy-Authorization and Cookie header values are always masked, other headers can be masked with Redact.
+func (r *Request) LogBodies(maxBytes int) *Request {
+	r.logBody = maxBytes
+
+	return r
+}
+
+// ConcurrencyLimit makes the request to take a slot in sem before sending, the slot is freed when the response body
+// is closed or the request fails. Requests sharing sem run at most cap(sem) at once.
+func (r *Request) ConcurrencyLimit(sem chan struct{}) *Request {
+	r.sem = sem
+
+	return r
+}
+
+// Redact masks values of headers and query args in log messages, the request itself is not changed.
+// Values with a scheme, like "Bearer <token>", keep the scheme.
+func (r *Request) Redact(headers []string, args []string) *Request {
+	r.redactH = append(r.redactH, headers...)
+	r.redactA = append(r.redactA, args...)
+
+	return r
+}
+
+func (r *Request) logURL(u *url.URL) string {
+	if len(r.redactA) == 0 || u.RawQuery == "" {
+		return u.String()
+	}
+
+	args := strings.Split(u.RawQuery, "&")
+
+	for i, arg := range args {
+		k, _, _ := strings.Cut(arg, "=")
+
+		if name, err := url.QueryUnescape(k); err == nil && slices.Contains(r.redactA, name) {
+			args[i] = k + "=***"
+		}
+	}
 
+	lu := *u
+	lu.RawQuery = strings.Join(args, "&")
+
+	return lu.String()
+}
+
+func (r *Request) logRawURL(raw string) string {
+	u, err := url.Parse(raw)
 	if err != nil {
-		return nil, err
+		return raw
 	}
 
-	if res.Body == nil {
-		return nil, fmt.Errorf("null body")
+	return r.logURL(u)
+}
+
+// logErr returns error message with the url in it redacted, e.g. for *url.Error.
+func (r *Request) logErr(u *url.URL, err error) string {
+	if len(r.redactA) == 0 {
+		return err.Error()
 	}
 
-	return res.Body, nil
+	return strings.ReplaceAll(err.Error(), u.String(), r.logURL(u))
 }
 
-func (r *Request) GetBody(ctx context.Context) ([]byte, error) {
-	res, err := r.DoRes(ctx)
+// redactErr masks query args in the url of the client error, callers log the errors they get back.
+func (r *Request) redactErr(err error) error {
+	ue, ok := err.(*url.Error)
+	if !ok || len(r.redactA) == 0 {
+		return err
+	}
 
-	if err != nil {
-		return nil, err
+	e := *ue
+	e.URL = r.logRawURL(ue.URL)
+
+	return &e
+}
+
+// secretHeaders are masked in logs without Redact.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+func (r *Request) logHeaders(h http.Header) string {
+	lh := h.Clone()
+
+	for _, k := range slices.Concat(secretHeaders, r.redactH) {
+		vals := lh[http.CanonicalHeaderKey(k)]
+
+		for i, v := range vals {
+			if scheme, _, ok := strings.Cut(v, " "); ok {
+				vals[i] = scheme + " ***"
+			} else {
+				vals[i] = "***"
+			}
+		}
 	}
 
-	if res.Body == nil {
-		return nil, fmt.Errorf("null body")
+	return fmt.Sprint(lh)
+}
+
+// LogSampleRate makes only given fraction of successful requests to be logged. Errors are always logged.
+func (r *Request) LogSampleRate(rate float64) *Request {
+	r.sample = &rate
+
+	return r
+}
+
+// Use adds middlewares around sending the request. The first one added is the outermost.
+func (r *Request) Use(mw ...Middleware) *Request {
+	r.mws = append(r.mws, mw...)
+
+	return r
+}
+
+// LastHeaders returns a copy of the headers of the last response received by this request.
+func (r *Request) LastHeaders() http.Header {
+	if h := r.lastHdr.Load(); h != nil {
+		return h.Clone()
 	}
 
-	defer res.Body.Close()
+	return nil
+}
 
-	return io.ReadAll(res.Body)
+// BytesRead returns the number of response body bytes read so far by all calls of this request.
+func (r *Request) BytesRead() int64 {
+	return r.read.Load()
 }
 
-func (r *Request) GetBodyStatus(ctx context.Context) (int, string, error) {
-	res, err := r.DoRes(ctx)
+func (r *Request) Build(ctx context.Context) (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
 
-	if res == nil {
-		return 0, "", err
+	// error of a failed body setter, a body set after it replaces it
+	if r.bodyErr != nil && r.body == nil && r.bodyFn == nil && r.file == "" {
+		return nil, r.bodyErr
 	}
 
-	if res.Body == nil {
-		return res.StatusCode, "", err
+	body := r.body
+
+	if r.bodyFn != nil {
+		b, err := r.bodyFn()
+		if err != nil {
+			return nil, err
+		}
+
+		body = b
 	}
 
-	defer res.Body.Close()
+	req, err := r.build(ctx, body)
+	if err != nil {
+		// body is closed on errors like http.Client.Do does, it also stops streaming body goroutines
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
 
-	b, err1 := io.ReadAll(res.Body)
+		return nil, err
+	}
 
-	return res.StatusCode, string(b), err1
+	return req, nil
 }
 
-func (r *Request) GetJSON(ctx context.Context, obj any) error {
-	b, err := r.Do(ctx)
-
+func (r *Request) build(ctx context.Context, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if r.balancer != nil {
+		r.balancer.rewrite(req.URL)
+		req.Host = req.URL.Host
 	}
 
-	dec := json.NewDecoder(b)
+	if r.file != "" {
+		if err := r.setBodyFile(req); err != nil {
+			return nil, err
+		}
+	}
 
-	return dec.Decode(obj)
+	if r.chunked {
+		req.ContentLength = -1
+		req.GetBody = nil
+	}
+
+	if r.length != nil {
+		req.ContentLength = *r.length
+	}
+
+	if !r.keepUA && stripUserAgent.Load() {
+		// nil value stops the transport from adding its default User-Agent
+		req.Header["User-Agent"] = nil
+	}
+
+	if r.expect {
+		req.Header.Set("Expect", "100-continue")
+	}
+
+	if len(r.headers) > 0 {
+		for k, v := range r.headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	for k, vals := range r.multi {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+
+	for k, v := range r.rawHdr {
+		req.Header[k] = []string{v}
+	}
+
+	if r.token != "" {
+		req.Header.Set("Authorization", r.authScheme()+" "+r.token)
+	} else {
+		if r.login != "" {
+			req.SetBasicAuth(r.login, r.passw)
+		}
+	}
+
+	r.applyArgs(req.URL)
+
+	for _, c := range r.cookies {
+		req.AddCookie(c)
+	}
+
+	if r.corrHdr != "" {
+		if id, ok := ctx.Value(r.corrKey).(string); ok && id != "" {
+			req.Header.Set(r.corrHdr, id)
+		}
+	}
+
+	if r.dlName != "" {
+		if dl, ok := ctx.Deadline(); ok {
+			req.Header.Set(r.dlName, r.dlFmt(time.Until(dl)))
+		}
+	}
+
+	if r.trace {
+		injectTraceContext(req)
+	}
+
+	if r.buffer {
+		if _, err := bufferBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.compress != nil {
+		if err := compressBody(req, *r.compress); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.md5 {
+		if err := setContentMD5(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.sign != nil {
+		if err := r.sign.apply(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.hdrFn != nil {
+		r.hdrFn(req.Header)
+	}
+
+	if r.before != nil {
+		if err := r.before(req); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+func (r *Request) DoRes(ctx context.Context) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", r.method, r.logRawURL(r.url), err)
+	}
+
+	if r.breaker != nil && !r.breaker.Allow() {
+		r.logger.Info(fmt.Sprintf("%s %s - circuit open", r.method, r.logRawURL(r.url)))
+
+		return nil, ErrCircuitOpen
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+
+	if tr := r.tr; tr != nil {
+		// private transport is not shared, so its connections are not kept after the request
+		cancelTimeout := cancel
+		cancel = func() {
+			cancelTimeout()
+			tr.CloseIdleConnections()
+		}
+	}
+
+	if r.sem != nil {
+		select {
+		case r.sem <- struct{}{}:
+		case <-ctx.Done():
+			cancel()
+
+			return nil, fmt.Errorf("%s %s: %w", r.method, r.logRawURL(r.url), ctx.Err())
+		}
+
+		cancelTimeout := cancel
+		cancel = sync.OnceFunc(func() {
+			cancelTimeout()
+			<-r.sem
+		})
+	}
+
+	var it *idleTimer
+
+	if r.idle > 0 {
+		var cancelIdle context.CancelFunc
+
+		ctx, it, cancelIdle = withIdleTimeout(ctx, r.idle)
+		cancelTimeout := cancel
+		cancel = func() {
+			cancelIdle()
+			cancelTimeout()
+		}
+	}
+
+	var cancelRead context.CancelCauseFunc
+
+	if r.readDL > 0 {
+		ctx, cancelRead = context.WithCancelCause(ctx)
+		cancelPrev := cancel
+		cancel = func() {
+			cancelRead(context.Canceled)
+			cancelPrev()
+		}
+	}
+
+	req, err := r.Build(ctx)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	var res *http.Response
+
+	if r.flight != nil && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		res, err = r.flight.do(ctx, flightKey(req), func() (*http.Response, error) {
+			return r.do(req)
+		})
+	} else {
+		res, err = r.do(req)
+	}
+
+	if it != nil {
+		err = it.err(err)
+	}
+
+	// body of error response is already read into memory
+	if res == nil || res.Body == nil || err != nil {
+		cancel()
+
+		return res, err
+	}
+
+	if it != nil {
+		res.Body = &idleBody{ReadCloser: res.Body, it: it}
+	}
+
+	if cancelRead != nil {
+		t := time.AfterFunc(r.readDL, func() { cancelRead(ErrBodyReadDeadline) })
+		res.Body = &deadlineBody{ReadCloser: res.Body, ctx: ctx}
+		cancelPrev := cancel
+		cancel = func() {
+			t.Stop()
+			cancelPrev()
+		}
+	}
+
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+
+	return res, err
+}
+
+func (r *Request) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		if d := time.Duration(defaultTimeout.Load()); d > 0 {
+			return context.WithTimeout(ctx, d)
+		}
+	}
+
+	return ctx, func() {}
+}
+
+func (r *Request) applyArgs(u *url.URL) {
+	r.applyMapArgs(u)
+
+	if len(r.ordered) == 0 && len(r.argFns) == 0 {
+		return
+	}
+
+	pairs := slices.Clone(r.ordered)
+
+	for _, a := range r.argFns {
+		pairs = append(pairs, [2]string{a.key, a.fn()})
+	}
+
+	parts := make([]string, 0, len(pairs)+1)
+
+	if u.RawQuery != "" {
+		parts = append(parts, u.RawQuery)
+	}
+
+	for _, p := range pairs {
+		if r.rawArgs {
+			parts = append(parts, p[0]+"="+p[1])
+		} else {
+			parts = append(parts, url.QueryEscape(p[0])+"="+url.QueryEscape(p[1]))
+		}
+	}
+
+	u.RawQuery = strings.Join(parts, "&")
+}
+
+func (r *Request) applyMapArgs(u *url.URL) {
+	if len(r.args) > 0 && r.rawArgs {
+		keys := make([]string, 0, len(r.args))
+
+		for k := range r.args {
+			keys = append(keys, k)
+		}
+
+		slices.Sort(keys)
+
+		parts := make([]string, 0, len(keys)+1)
+
+		if u.RawQuery != "" {
+			parts = append(parts, u.RawQuery)
+		}
+
+		for _, k := range keys {
+			parts = append(parts, k+"="+r.args[k])
+		}
+
+		u.RawQuery = strings.Join(parts, "&")
+
+		return
+	}
+
+	if len(r.args) > 0 {
+		q := u.Query()
+
+		for k, v := range r.args {
+			q.Add(k, v)
+		}
+
+		u.RawQuery = q.Encode()
+	}
+}
+
+// do sends the request, trying fallback urls if needed.
+func (r *Request) do(req *http.Request) (*http.Response, error) {
+	res, err := r.sendAuth(req)
+
+	for _, rawURL := range r.backup {
+		if err == nil || (res != nil && res.StatusCode < 500) {
+			break
+		}
+
+		u, err1 := url.Parse(rawURL)
+		if err1 != nil {
+			return res, err
+		}
+
+		r.applyArgs(u)
+
+		next, err1 := replay(req)
+		if err1 != nil {
+			return res, err
+		}
+
+		next.URL = u
+		next.Host = u.Host
+
+		if res != nil {
+			res.Body.Close()
+		}
+
+		res, err = r.sendAuth(next)
+	}
+
+	return res, err
+}
+
+// sendAuth sends the request and resends it with refreshed token on 401.
+func (r *Request) sendAuth(req *http.Request) (*http.Response, error) {
+	res, err := r.sendRetry(req)
+
+	if r.refresh == nil || res == nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	next, err1 := replay(req)
+	if err1 != nil {
+		return res, err
+	}
+
+	token, err1 := r.refresh(req.Context())
+	if err1 != nil {
+		r.logger.Warn(fmt.Sprintf("%s %s - token refresh error %s", r.method, r.logURL(req.URL), r.logErr(req.URL, err1)))
+
+		return res, err
+	}
+
+	res.Body.Close()
+
+	r.token = token
+	next.Header.Set("Authorization", r.authScheme()+" "+token)
+
+	return r.sendRetry(next)
+}
+
+func (r *Request) authScheme() string {
+	if r.scheme == "" {
+		return "Bearer"
+	}
+
+	return r.scheme
+}
+
+// replay returns a copy of the sent request with a fresh body.
+func replay(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("request body can't be replayed")
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		next.Body = body
+	}
+
+	return next, nil
+}
+
+func (r *Request) send(req *http.Request) (*http.Response, error) {
+	c := r.httpClient()
+
+	fn := func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		return c.Do(req.WithContext(ctx))
+	}
+
+	for i := len(r.mws) - 1; i >= 0; i-- {
+		fn = r.mws[i](fn)
+	}
+
+	if r.logBody > 0 {
+		r.logRequestBody(req)
+	}
+
+	res, err := fn(req.Context(), req)
+
+	if r.breaker != nil {
+		r.breaker.Report(err == nil && res.StatusCode < 500)
+	}
+
+	if err != nil {
+		r.logger.Info(fmt.Sprintf("%s %s - error %s", r.method, r.logURL(req.URL), r.logErr(req.URL, err)))
+
+		return res, r.redactErr(err)
+	}
+
+	h := res.Header.Clone()
+	r.lastHdr.Store(&h)
+
+	empty := noBody(req, res)
+	res.Body = &countingBody{ReadCloser: res.Body, n: &r.read}
+
+	if r.gzip && !empty && strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		if err := gunzip(res); err != nil {
+			r.logger.Info(fmt.Sprintf("%s %s - error %s", r.method, r.logURL(req.URL), r.logErr(req.URL, err)))
+
+			return nil, err
+		}
+	}
+
+	if r.logBody > 0 {
+		if err := r.logResponseBody(req, res); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.tee != nil {
+		res.Body = &readerBody{Reader: io.TeeReader(res.Body, r.tee), body: res.Body}
+	}
+
+	if res.StatusCode > 399 && !r.noStatus {
+		r.logger.Warn(fmt.Sprintf("%s %s - %d", r.method, r.logURL(req.URL), res.StatusCode))
+
+		return res, newStatusError(res)
+	}
+
+	if err := r.checkHeaders(res); err != nil {
+		r.logger.Warn(fmt.Sprintf("%s %s - %s", r.method, r.logURL(req.URL), r.logErr(req.URL, err)))
+		drainBody(res.Body)
+
+		return nil, err
+	}
+
+	if want := res.Header.Get("Content-MD5"); r.checkMD5 && want != "" {
+		res.Body = &md5Body{ReadCloser: res.Body, want: want, h: md5.New()}
+	}
+
+	if r.sample == nil || rand.Float64() < *r.sample {
+		r.logger.Debug(fmt.Sprintf("%s %s - %d", r.method, r.logURL(req.URL), res.StatusCode))
+	}
+
+	return res, nil
+}
+
+func (r *Request) logRequestBody(req *http.Request) {
+	r.logger.Debug(fmt.Sprintf("%s %s - request headers %s", r.method, r.logURL(req.URL), r.logHeaders(req.Header)))
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+
+	logBody := func(b []byte) {
+		r.logger.Debug(fmt.Sprintf("%s %s - request body %q", r.method, r.logURL(req.URL), b))
+	}
+
+	if req.GetBody == nil {
+		req.Body = &prefixBody{ReadCloser: req.Body, max: r.logBody, fn: logBody}
+
+		return
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(body, int64(r.logBody)))
+	body.Close()
+
+	logBody(b)
+}
+
+// prefixBody passes the first max bytes read from the body to fn, when they are read or the body ends or is closed.
+type prefixBody struct {
+	io.ReadCloser
+	max    int
+	fn     func([]byte)
+	mx     sync.Mutex
+	buf    []byte
+	logged bool
+}
+
+func (p *prefixBody) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if k := min(n, p.max-len(p.buf)); k > 0 {
+		p.buf = append(p.buf, b[:k]...)
+	}
+
+	if len(p.buf) >= p.max || err != nil {
+		p.flush()
+	}
+
+	return n, err
+}
+
+func (p *prefixBody) Close() error {
+	p.mx.Lock()
+	p.flush()
+	p.mx.Unlock()
+
+	return p.ReadCloser.Close()
+}
+
+func (p *prefixBody) flush() {
+	if !p.logged {
+		p.logged = true
+		p.fn(p.buf)
+	}
+}
+
+// logResponseBody reads the start of the response body and puts it back in front of the rest.
+func (r *Request) logResponseBody(req *http.Request, res *http.Response) error {
+	b, err := io.ReadAll(io.LimitReader(res.Body, int64(r.logBody)))
+	if err != nil {
+		res.Body.Close()
+
+		return err
+	}
+
+	r.logger.Debug(fmt.Sprintf("%s %s - response body %q", r.method, r.logURL(req.URL), b))
+	res.Body = &readerBody{Reader: io.MultiReader(bytes.NewReader(b), res.Body), body: res.Body}
+
+	return nil
+}
+
+func (r *Request) Do(ctx context.Context) (io.ReadCloser, error) {
+	res, err := r.DoRes(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body == nil {
+		return nil, fmt.Errorf("null body")
+	}
+
+	return res.Body, nil
+}
+
+func (r *Request) GetBody(ctx context.Context) ([]byte, error) {
+	res, err := r.DoRes(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body == nil {
+		return nil, fmt.Errorf("null body")
+	}
+
+	defer res.Body.Close()
+
+	return io.ReadAll(res.Body)
+}
+
+// GetBodyCookies returns response body and cookies set by the response.
+func (r *Request) GetBodyCookies(ctx context.Context) ([]byte, []*http.Cookie, error) {
+	res, err := r.DoRes(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+
+	return b, res.Cookies(), err
+}
+
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// GetBodyBuffer reads the response body into a buffer from a pool. The buffer is valid until release is called,
+// release returns it to the pool and must be called exactly once, after that the buffer and its bytes must not be used.
+func (r *Request) GetBodyBuffer(ctx context.Context) (*bytes.Buffer, func(), error) {
+	res, err := r.DoRes(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer res.Body.Close()
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	release := func() {
+		buf.Reset()
+		bufPool.Put(buf)
+	}
+
+	if _, err := buf.ReadFrom(res.Body); err != nil {
+		release()
+
+		return nil, nil, err
+	}
+
+	return buf, release, nil
+}
+
+// GetBodyTimeout is GetBody with a timeout derived from parent context.
+func (r *Request) GetBodyTimeout(parent context.Context, d time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(parent, d)
+	defer cancel()
+
+	return r.GetBody(ctx)
+}
+
+func (r *Request) GetBodyStatus(ctx context.Context) (int, string, error) {
+	res, err := r.DoRes(ctx)
+
+	if res == nil {
+		return 0, "", err
+	}
+
+	if res.Body == nil {
+		return res.StatusCode, "", err
+	}
+
+	defer res.Body.Close()
+
+	b, err1 := io.ReadAll(res.Body)
+
+	return res.StatusCode, string(b), err1
+}
+
+// HeadInfo sends HEAD request and returns advertised size, -1 if unknown, content type and if the server accepts byte ranges.
+func (r *Request) HeadInfo(ctx context.Context) (size int64, contentType string, supportsRange bool, err error) {
+	method := r.method
+	r.method = http.MethodHead
+
+	res, err := r.DoRes(ctx)
+
+	r.method = method
+
+	if err != nil {
+		return -1, "", false, err
+	}
+
+	res.Body.Close()
+
+	for _, v := range strings.Split(res.Header.Get("Accept-Ranges"), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "bytes") {
+			supportsRange = true
+		}
+	}
+
+	return res.ContentLength, res.Header.Get("Content-Type"), supportsRange, nil
+}
+
+// ExpectStatus returns response body if the response status is want, otherwise an error with the status and the body start.
+func (r *Request) ExpectStatus(ctx context.Context, want int) ([]byte, error) {
+	res, err := r.DoRes(ctx)
+	if res == nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+
+	if res.StatusCode != want {
+		snippet := b
+		if len(snippet) > 200 {
+			snippet = snippet[:200]
+		}
+
+		return nil, fmt.Errorf("status is %d, want %d, body: %q", res.StatusCode, want, snippet)
+	}
+
+	return b, err
+}
+
+// RequireHeader makes successful responses without header k, or with a value other than v, to fail.
+// Empty v requires only presence of the header.
+func (r *Request) RequireHeader(k, v string) *Request {
+	if r.required == nil {
+		r.required = make(map[string]string)
+	}
+
+	r.required[k] = v
+
+	return r
+}
+
+// AcceptContentTypes makes successful responses with Content-Type media type not in types to fail.
+func (r *Request) AcceptContentTypes(types ...string) *Request {
+	r.ctypes = append(r.ctypes, types...)
+
+	return r
+}
+
+func (r *Request) checkHeaders(res *http.Response) error {
+	if len(r.ctypes) > 0 {
+		ct := res.Header.Get("Content-Type")
+		mt, _, _ := mime.ParseMediaType(ct)
+
+		if !slices.ContainsFunc(r.ctypes, func(t string) bool { return strings.EqualFold(t, mt) }) {
+			return fmt.Errorf("content type %q is not one of %s", ct, strings.Join(r.ctypes, ", "))
+		}
+	}
+
+	for k, v := range r.required {
+		vals, ok := res.Header[http.CanonicalHeaderKey(k)]
+
+		switch {
+		case !ok:
+			return fmt.Errorf("required header %s is missing", k)
+		case v != "" && !slices.Contains(vals, v):
+			return fmt.Errorf("header %s is %q, want %q", k, strings.Join(vals, ", "), v)
+		}
+	}
+
+	return nil
+}
+
+// IgnoreStatus makes responses with any status to be returned without error, only transport errors are returned.
+func (r *Request) IgnoreStatus() *Request {
+	r.noStatus = true
+
+	return r
+}
+
+// StrictJSON makes json decoding fail on fields that are not present in the target struct.
+func (r *Request) StrictJSON() *Request {
+	r.strict = true
+
+	return r
+}
+
+// JSONDecoder sets the function used to decode json responses instead of encoding/json, e.g. a faster one.
+// StrictJSON and number handling of GetJSONNumber are then up to fn.
+func (r *Request) JSONDecoder(fn func(io.Reader, any) error) *Request {
+	r.decoder = fn
+
+	return r
+}
+
+func (r *Request) GetJSON(ctx context.Context, obj any) error {
+	return r.getJSON(ctx, obj, false)
+}
+
+// GetValidated decodes json response into obj and checks it with validate, e.g. go-playground/validator Struct method.
+func (r *Request) GetValidated(ctx context.Context, obj any, validate func(any) error) error {
+	if err := r.GetJSON(ctx, obj); err != nil {
+		return err
+	}
+
+	if err := validate(obj); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+
+	return nil
+}
+
+// Get sends the request and returns json response decoded into T.
+func Get[T any](ctx context.Context, r *Request) (T, error) {
+	var v T
+
+	if err := r.GetJSON(ctx, &v); err != nil {
+		var zero T
+
+		return zero, err
+	}
+
+	return v, nil
+}
+
+// EnvelopeError is the error field of response envelope returned by GetEnvelope. Raw is the field json as is.
+type EnvelopeError struct {
+	Message string
+	Raw     json.RawMessage
+}
+
+func (e *EnvelopeError) Error() string {
+	return "response error: " + e.Message
+}
+
+// GetEnvelope decodes {"data": ..., "error": ...} response and returns data as T. Error field other than null,
+// empty string or false is returned as *EnvelopeError, its message is the error string or the "message" field
+// of the error object.
+func GetEnvelope[T any](ctx context.Context, r *Request) (T, error) {
+	var (
+		zero T
+		env  struct {
+			Data  T               `json:"data"`
+			Error json.RawMessage `json:"error"`
+		}
+	)
+
+	if err := r.GetJSON(ctx, &env); err != nil {
+		return zero, err
+	}
+
+	switch string(env.Error) {
+	case "", "null", `""`, "false":
+		return env.Data, nil
+	}
+
+	e := &EnvelopeError{Message: string(env.Error), Raw: env.Error}
+
+	var obj struct {
+		Message string `json:"message"`
+	}
+
+	if json.Unmarshal(env.Error, &e.Message) != nil && json.Unmarshal(env.Error, &obj) == nil && obj.Message != "" {
+		e.Message = obj.Message
+	}
+
+	return zero, e
+}
+
+// PaginateJSON requests pages starting from the request url and collects items returned by extract.
+// extract returns items of the page and the url of the next page, relative to the current one, or "" for the last page.
+func PaginateJSON[T any](ctx context.Context, r *Request, extract func(body []byte) ([]T, string, error)) ([]T, error) {
+	var all []T
+
+	defer func(u string) { r.url = u }(r.url)
+
+	for {
+		b, err := r.GetBody(ctx)
+		if err != nil {
+			return all, err
+		}
+
+		items, next, err := extract(b)
+		if err != nil {
+			return all, err
+		}
+
+		all = append(all, items...)
+
+		if next == "" {
+			return all, nil
+		}
+
+		cur, err := url.Parse(r.url)
+		if err != nil {
+			return all, err
+		}
+
+		u, err := cur.Parse(next)
+		if err != nil {
+			return all, fmt.Errorf("invalid next page url %q: %w", next, err)
+		}
+
+		r.url = u.String()
+	}
+}
+
+// GetJSONNumber is like GetJSON, but numbers decoded into interface values become json.Number instead of float64,
+// so big integers keep their precision.
+func (r *Request) GetJSONNumber(ctx context.Context, obj any) error {
+	return r.getJSON(ctx, obj, true)
+}
+
+// GetJSONMap decodes json object response into a map, numbers are json.Number. Other json values are an error.
+func (r *Request) GetJSONMap(ctx context.Context) (map[string]any, error) {
+	var v any
+
+	if err := r.getJSON(ctx, &v, true); err != nil {
+		return nil, err
+	}
+
+	switch m := v.(type) {
+	case map[string]any:
+		return m, nil
+	case nil:
+		return nil, errors.New("json response is empty or null, not an object")
+	case []any:
+		return nil, errors.New("json response is an array, not an object")
+	default:
+		return nil, fmt.Errorf("json response is %T, not an object", v)
+	}
+}
+
+// keep saves method, body and headers, the returned func restores them. Helpers that change the request to send it
+// restore it after, so the Request can be reused as it was configured.
+func (r *Request) keep() func() {
+	method, body, headers := r.method, r.body, maps.Clone(r.headers)
+
+	return func() {
+		r.method, r.body, r.headers = method, body, headers
+	}
+}
+
+// PostJSONOK posts obj as json and returns nil if the response status is 2xx, the response body is discarded.
+// Other statuses are returned as *StatusError. Method, body and headers of the Request are restored after the call.
+func (r *Request) PostJSONOK(ctx context.Context, obj any) error {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	defer r.keep()()
+
+	r.method = http.MethodPost
+	r.body = bytes.NewReader(b)
+	r.AddHeader("Content-Type", "application/json")
+
+	res, err := r.DoRes(ctx)
+	if err != nil {
+		if res != nil {
+			drainBody(res.Body)
+		}
+
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newStatusError(res)
+	}
+
+	drainBody(res.Body)
+
+	return nil
+}
+
+// ConditionalUpdate gets the resource with its ETag, makes the new body from the current one with getBody
+// and puts it with If-Match. On 412 the whole cycle is repeated, up to maxAttempts times.
+// Method, body and headers of the Request are restored after the call.
+func (r *Request) ConditionalUpdate(ctx context.Context, getBody func(current []byte) (io.Reader, error), maxAttempts int) error {
+	if maxAttempts <= 0 {
+		return fmt.Errorf("invalid max attempts %d", maxAttempts)
+	}
+
+	defer r.keep()()
+
+	var err error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		r.method = http.MethodGet
+		r.body = nil
+		delete(r.headers, "If-Match")
+
+		res, err1 := r.DoRes(ctx)
+		if err1 != nil {
+			return err1
+		}
+
+		cur, err1 := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if err1 != nil {
+			return err1
+		}
+
+		etag := res.Header.Get("ETag")
+		if etag == "" {
+			return errors.New("response has no ETag")
+		}
+
+		body, err1 := getBody(cur)
+		if err1 != nil {
+			return err1
+		}
+
+		r.method = http.MethodPut
+		r.body = body
+		r.IfMatch(etag)
+
+		res, err = r.DoRes(ctx)
+		if res != nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		var se *StatusError
+		if !errors.As(err, &se) || se.Code != http.StatusPreconditionFailed {
+			return err
+		}
+	}
+
+	return fmt.Errorf("update conflict after %d attempts: %w", maxAttempts, err)
+}
+
+// PostNDJSONBatches posts items as newline delimited json, batchSize items per request. It stops on the first error,
+// that is returned with the index of the failed batch. Method, body and headers of the Request are restored after the call.
+func (r *Request) PostNDJSONBatches(ctx context.Context, items []any, batchSize int) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d", batchSize)
+	}
+
+	defer r.keep()()
+
+	r.method = http.MethodPost
+	r.AddHeader("Content-Type", "application/x-ndjson")
+
+	for i := 0; i*batchSize < len(items); i++ {
+		var buf bytes.Buffer
+
+		enc := json.NewEncoder(&buf)
+
+		for _, v := range items[i*batchSize : min((i+1)*batchSize, len(items))] {
+			if err := enc.Encode(v); err != nil {
+				return fmt.Errorf("batch %d: %w", i, err)
+			}
+		}
+
+		r.body = bytes.NewReader(buf.Bytes())
+
+		res, err := r.DoRes(ctx)
+		if res != nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		if err != nil {
+			return fmt.Errorf("batch %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// GetJSONStatus decodes json response into obj and returns the response status. On error status the StatusError is returned
+// with the status.
+func (r *Request) GetJSONStatus(ctx context.Context, obj any) (int, error) {
+	res, err := r.DoRes(ctx)
+	if res == nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	if err != nil {
+		return res.StatusCode, err
+	}
+
+	return res.StatusCode, r.decodeJSON(res.Body, obj, false)
+}
+
+// GetJSONWithCount decodes json response into obj and returns integer value of countHeader, e.g. X-Total-Count.
+// Missing or invalid header gives -1 without error.
+func (r *Request) GetJSONWithCount(ctx context.Context, obj any, countHeader string) (int, error) {
+	res, err := r.DoRes(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	defer res.Body.Close()
+
+	if err := r.decodeJSON(res.Body, obj, false); err != nil {
+		return -1, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(res.Header.Get(countHeader)))
+	if err != nil {
+		return -1, nil
+	}
+
+	return n, nil
+}
+
+// GetJSONRaw decodes json response into obj and returns the raw body as well.
+func (r *Request) GetJSONRaw(ctx context.Context, obj any) ([]byte, error) {
+	b, err := r.GetBody(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, r.decodeJSON(bytes.NewReader(b), obj, false)
+}
+
+func (r *Request) getJSON(ctx context.Context, obj any, useNumber bool) error {
+	b, err := r.Do(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer b.Close()
+
+	return r.decodeJSON(b, obj, useNumber)
+}
+
+// decodeJSON decodes json from rd into obj. Empty body is not an error and leaves obj untouched.
+func (r *Request) decodeJSON(rd io.Reader, obj any, useNumber bool) error {
+	br := bufio.NewReader(rd)
+
+	if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if r.decoder != nil {
+		return r.decoder(br, obj)
+	}
+
+	dec := json.NewDecoder(br)
+
+	if useNumber {
+		dec.UseNumber()
+	}
+
+	if r.strict {
+		dec.DisallowUnknownFields()
+	}
+
+	return dec.Decode(obj)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+
+	return n, err
+}
+
+// cancelBody releases request context when the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelBody) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+
+	return err
+}
+
+// noBody reports if the response can't have a body, servers may send Content-Encoding for such responses too.
+func noBody(req *http.Request, res *http.Response) bool {
+	switch {
+	case req.Method == http.MethodHead, res.StatusCode == http.StatusNoContent, res.StatusCode == http.StatusNotModified:
+		return true
+	default:
+		return res.Body == nil || res.Body == http.NoBody || res.ContentLength == 0
+	}
+}
+
+func gunzip(res *http.Response) error {
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		res.Body.Close()
+
+		return fmt.Errorf("invalid gzip response: %w", err)
+	}
+
+	res.Body = &gzipBody{Reader: gz, body: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return nil
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (g *gzipBody) Close() error {
+	g.Reader.Close()
+
+	return g.body.Close()
+}
+
+// readerBody reads from Reader and closes the original body.
+type readerBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+func (p *readerBody) Close() error {
+	return p.body.Close()
 }
@@ -0,0 +1,1983 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAddHeaderMulti(t *testing.T) {
+	var got []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Values("X-Foo")
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).
+		AddHeader("X-Foo", "a").
+		AddHeaderMulti("X-Foo", "b", "c").
+		AddHeaderMulti("X-Foo", "d").
+		GetBody(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+type countingReader struct {
+	n     int64
+	limit int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.n >= c.limit {
+		return 0, io.EOF
+	}
+
+	if rest := c.limit - c.n; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	c.n += int64(len(p))
+
+	return len(p), nil
+}
+
+func TestExpect100Continue(t *testing.T) {
+	var expect string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect = r.Header.Get("Expect")
+		w.WriteHeader(http.StatusExpectationFailed)
+	}))
+	defer srv.Close()
+
+	body := &countingReader{limit: 64 << 20}
+
+	res, err := New(srv.Client(), nil).URL(srv.URL).Put().Body(body).Expect100Continue().DoRes(context.Background())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if res == nil || res.StatusCode != http.StatusExpectationFailed {
+		t.Fatalf("expected 417 response, got %v", res)
+	}
+
+	if expect != "100-continue" {
+		t.Errorf("server got Expect %q", expect)
+	}
+
+	if body.n >= body.limit {
+		t.Errorf("whole body was sent")
+	}
+}
+
+func TestAuthUserInfo(t *testing.T) {
+	tests := []struct {
+		userinfo string
+		login    string
+		passw    string
+		ok       bool
+	}{
+		{"user:pa:ss", "user", "pa:ss", true},
+		{"user", "user", "", true},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		var (
+			login, passw string
+			ok           bool
+		)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			login, passw, ok = r.BasicAuth()
+		}))
+
+		_, err := New(srv.Client(), nil).URL(srv.URL).AuthUserInfo(tt.userinfo).GetBody(context.Background())
+		srv.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if login != tt.login || passw != tt.passw || ok != tt.ok {
+			t.Errorf("%q: got %q %q %v", tt.userinfo, login, passw, ok)
+		}
+	}
+}
+
+func TestHeaderTransform(t *testing.T) {
+	var h http.Header
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h = r.Header
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).
+		AddHeader("X-Secret", "s").
+		AddHeader("X-Keep", "k").
+		HeaderTransform(func(h http.Header) {
+			h.Del("X-Secret")
+			h.Set("X-Injected", "i")
+		}).
+		GetBody(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Get("X-Secret") != "" || h.Get("X-Keep") != "k" || h.Get("X-Injected") != "i" {
+		t.Errorf("got headers %v", h)
+	}
+}
+
+// uaTransport adds User-Agent to requests that don't have the header at all.
+type uaTransport struct {
+	next http.RoundTripper
+}
+
+func (t uaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", "team-agent/1.0")
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+func TestKeepUserAgent(t *testing.T) {
+	var ua []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Values("User-Agent")
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: uaTransport{next: srv.Client().Transport}}
+
+	if _, err := New(c, nil).URL(srv.URL).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ua, []string{"team-agent/1.0"}) {
+		t.Errorf("expected transport User-Agent by default, got %v", ua)
+	}
+
+	SetStripUserAgent(true)
+	defer SetStripUserAgent(false)
+
+	if _, err := New(c, nil).URL(srv.URL).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ua) != 0 {
+		t.Errorf("expected no User-Agent when stripped, got %v", ua)
+	}
+
+	if _, err := New(c, nil).URL(srv.URL).KeepUserAgent().GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ua, []string{"team-agent/1.0"}) {
+		t.Errorf("got User-Agent %v", ua)
+	}
+
+	if _, err := New(c, nil).URL(srv.URL).AddHeader("User-Agent", "explicit").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ua, []string{"explicit"}) {
+		t.Errorf("got User-Agent %v", ua)
+	}
+}
+
+func TestBytesRead(t *testing.T) {
+	data := strings.Repeat("x", 100_000)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(data))
+	}))
+	defer srv.Close()
+
+	r := New(srv.Client(), nil).URL(srv.URL)
+
+	if _, err := r.GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := r.BytesRead(); n != int64(len(data)) {
+		t.Errorf("got %d bytes after GetBody", n)
+	}
+
+	body, err := r.Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = io.CopyN(io.Discard, body, 1000)
+
+	if n := r.BytesRead(); n < int64(len(data))+1000 {
+		t.Errorf("got %d bytes after partial read", n)
+	}
+
+	_, _ = io.Copy(io.Discard, body)
+	body.Close()
+
+	if n := r.BytesRead(); n != int64(len(data))*2 {
+		t.Errorf("got %d bytes after full read", n)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	var query, body string
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		query = r.URL.RawQuery
+		_, _ = w.Write([]byte("from backup"))
+	}))
+	defer backup.Close()
+
+	b, err := New(primary.Client(), nil).URL(primary.URL).
+		Fallback("http://127.0.0.1:1", backup.URL).
+		Post().
+		Args(map[string]string{"a": "1"}).
+		Body(strings.NewReader("payload")).
+		GetBody(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "from backup" {
+		t.Errorf("got %q", b)
+	}
+
+	if body != "payload" || query != "a=1" {
+		t.Errorf("backup got body %q and query %q", body, query)
+	}
+}
+
+func TestFallbackSkipped4xx(t *testing.T) {
+	var hits int
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer backup.Close()
+
+	if _, err := New(primary.Client(), nil).URL(primary.URL).Fallback(backup.URL).GetBody(context.Background()); err == nil {
+		t.Error("expected error")
+	}
+
+	if hits != 0 {
+		t.Errorf("fallback was called on 404")
+	}
+}
+
+func TestRawArgs(t *testing.T) {
+	var query string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	args := map[string]string{"q": "a%20b", "p": "1"}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL + "?x=y").Args(args).RawArgs().GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if query != "x=y&p=1&q=a%20b" {
+		t.Errorf("got query %q", query)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Args(args).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if query != "p=1&q=a%2520b" {
+		t.Errorf("got query %q", query)
+	}
+}
+
+func TestPropagateDeadline(t *testing.T) {
+	var timeout []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout = r.Header.Values("X-Timeout-Ms")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).PropagateDeadline("X-Timeout-Ms").GetBody(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(timeout) != 1 {
+		t.Fatalf("got header %v", timeout)
+	}
+
+	if ms, _ := strconv.Atoi(timeout[0]); ms < 1900 || ms > 2000 {
+		t.Errorf("got timeout %s", timeout[0])
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).PropagateDeadline("X-Timeout-Ms").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(timeout) != 0 {
+		t.Errorf("got header %v without deadline", timeout)
+	}
+}
+
+func TestGetJSONNumber(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":1234567890123456789}`))
+	}))
+	defer srv.Close()
+
+	var m map[string]any
+
+	if err := New(srv.Client(), nil).URL(srv.URL).GetJSONNumber(context.Background(), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	n, ok := m["id"].(json.Number)
+	if !ok {
+		t.Fatalf("got %T", m["id"])
+	}
+
+	if id, err := n.Int64(); err != nil || id != 1234567890123456789 {
+		t.Errorf("got %s", n)
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name":"a","extra":1}`))
+	}))
+	defer srv.Close()
+
+	var v struct {
+		Name string `json:"name"`
+	}
+
+	if err := New(srv.Client(), nil).URL(srv.URL).GetJSON(context.Background(), &v); err != nil || v.Name != "a" {
+		t.Fatalf("got %v, %+v", err, v)
+	}
+
+	if err := New(srv.Client(), nil).URL(srv.URL).StrictJSON().GetJSON(context.Background(), &v); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestGetBodyTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Millisecond * 300)
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL+"/slow").GetBodyTimeout(context.Background(), time.Millisecond*50); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+
+	b, err := New(srv.Client(), nil).URL(srv.URL).GetBodyTimeout(context.Background(), time.Second)
+	if err != nil || string(b) != "ok" {
+		t.Errorf("got %q, %v", b, err)
+	}
+}
+
+func TestRawHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	head := make(chan string, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var sb strings.Builder
+
+		rd := bufio.NewReader(conn)
+
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+
+			sb.WriteString(line)
+		}
+
+		head <- sb.String()
+
+		_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+	}()
+
+	if _, err := New(&http.Client{}, nil).URL("http://"+l.Addr().String()).RawHeader("X-MyHeader", "v").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := <-head; !strings.Contains(h, "\r\nX-MyHeader: v\r\n") {
+		t.Errorf("header casing is lost:\n%s", h)
+	}
+}
+
+func TestUse(t *testing.T) {
+	var (
+		order []string
+		hdr   string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdr = r.Header.Get("X-Trace")
+		order = append(order, "server")
+	}))
+	defer srv.Close()
+
+	mw := func(name string) Middleware {
+		return func(next RoundFunc) RoundFunc {
+			return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+				order = append(order, name+" before")
+				req.Header.Set("X-Trace", req.Header.Get("X-Trace")+name)
+				res, err := next(ctx, req)
+				order = append(order, name+" after")
+
+				return res, err
+			}
+		}
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Use(mw("a"), mw("b")).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a before", "b before", "server", "b after", "a after"}
+
+	if !slices.Equal(order, want) {
+		t.Errorf("got order %v", order)
+	}
+
+	if hdr != "ab" {
+		t.Errorf("got header %q", hdr)
+	}
+}
+
+func TestGetJSONRaw(t *testing.T) {
+	payload := `{"id": 7, "name": "x"}`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(payload))
+	}))
+	defer srv.Close()
+
+	var v struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	raw, err := New(srv.Client(), nil).URL(srv.URL).GetJSONRaw(context.Background(), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.ID != 7 || v.Name != "x" || string(raw) != payload {
+		t.Errorf("got %+v, raw %q", v, raw)
+	}
+}
+
+func testLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLogSampleRate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	for _, rate := range []float64{0, 1} {
+		buf := new(bytes.Buffer)
+
+		for i := 0; i < 10; i++ {
+			if _, err := New(srv.Client(), testLogger(buf)).URL(srv.URL).LogSampleRate(rate).GetBody(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n := strings.Count(buf.String(), "level=DEBUG"); n != int(rate*10) {
+			t.Errorf("rate %v: got %d success logs", rate, n)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	_, _ = New(srv.Client(), testLogger(buf)).URL(srv.URL + "/fail").LogSampleRate(0).GetBody(context.Background())
+
+	if !strings.Contains(buf.String(), "level=WARN") {
+		t.Errorf("error was not logged: %s", buf)
+	}
+}
+
+func TestGet(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			_, _ = w.Write([]byte(`{"id": "x"}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id": 1, "name": "alice"}`))
+	}))
+	defer srv.Close()
+
+	u, err := Get[user](context.Background(), New(srv.Client(), nil).URL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u != (user{ID: 1, Name: "alice"}) {
+		t.Errorf("got %+v", u)
+	}
+
+	u, err = Get[user](context.Background(), New(srv.Client(), nil).URL(srv.URL+"/bad"))
+	if err == nil || u != (user{}) {
+		t.Errorf("expected zero value and error, got %+v, %v", u, err)
+	}
+}
+
+func TestExpectStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusConflict)
+		}
+
+		_, _ = w.Write([]byte("already exists"))
+	}))
+	defer srv.Close()
+
+	b, err := New(srv.Client(), nil).URL(srv.URL).Post().ExpectStatus(context.Background(), http.StatusCreated)
+	if err != nil || string(b) != "already exists" {
+		t.Errorf("got %q, %v", b, err)
+	}
+
+	_, err = New(srv.Client(), nil).URL(srv.URL).ExpectStatus(context.Background(), http.StatusOK)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "409") || !strings.Contains(msg, "200") || !strings.Contains(msg, "already exists") {
+		t.Errorf("unclear error %q", msg)
+	}
+}
+
+func TestReferer(t *testing.T) {
+	var ref string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref = r.Referer()
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Referer("https://example.com/page").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ref != "https://example.com/page" {
+		t.Errorf("got referer %q", ref)
+	}
+}
+
+func TestBefore(t *testing.T) {
+	var (
+		hits int
+		hdr  string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		hdr = r.Header.Get("X-Hook")
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).Before(func(req *http.Request) error {
+		req.Header.Set("X-Hook", req.Method)
+
+		return nil
+	}).GetBody(context.Background())
+
+	if err != nil || hdr != "GET" {
+		t.Errorf("got header %q, %v", hdr, err)
+	}
+
+	errAbort := errors.New("abort")
+
+	_, err = New(srv.Client(), nil).URL(srv.URL).Before(func(req *http.Request) error {
+		return errAbort
+	}).GetBody(context.Background())
+
+	if !errors.Is(err, errAbort) || hits != 1 {
+		t.Errorf("got %v after %d hits", err, hits)
+	}
+}
+
+func TestMaxRedirects(t *testing.T) {
+	var hops int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		hops = n
+		http.Redirect(w, r, fmt.Sprintf("/%d", n+1), http.StatusFound)
+	}))
+	defer srv.Close()
+
+	res, err := New(srv.Client(), nil).URL(srv.URL + "/0").MaxRedirects(3).DoRes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound || res.Header.Get("Location") != "/4" || hops != 3 {
+		t.Errorf("got %d to %q after %d hops", res.StatusCode, res.Header.Get("Location"), hops)
+	}
+}
+
+func TestCookieHeader(t *testing.T) {
+	var cookies []*http.Cookie
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies = r.Cookies()
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).CookieHeader(`a=1; broken; =x; b="2"`).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, c := range cookies {
+		got = append(got, c.Name+"="+c.Value)
+	}
+
+	if !slices.Equal(got, []string{"a=1", "b=2"}) {
+		t.Errorf("got cookies %v", got)
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Millisecond * 300):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	SetDefaultTimeout(time.Millisecond * 50)
+	defer SetDefaultTimeout(0)
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).GetBody(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected default timeout, got %v", err)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Timeout(time.Second).GetBody(context.Background()); err != nil {
+		t.Errorf("request timeout did not override default: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).GetBody(ctx); err != nil {
+		t.Errorf("default timeout shortened context deadline: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Timeout(time.Second).GetBody(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("request timeout extended context deadline: %v", err)
+	}
+}
+
+func TestGetJSONEmptyBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			_, _ = w.Write([]byte(`{"name":`))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	v := map[string]any{"keep": true}
+
+	if err := New(srv.Client(), nil).URL(srv.URL).GetJSON(context.Background(), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v) != 1 || v["keep"] != true {
+		t.Errorf("object was changed: %v", v)
+	}
+
+	if err := New(srv.Client(), nil).URL(srv.URL+"/bad").GetJSON(context.Background(), &v); err == nil {
+		t.Error("expected error for malformed body")
+	}
+}
+
+func TestGetJSONStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":5}`))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	var v struct{ ID int }
+
+	code, err := New(srv.Client(), nil).URL(srv.URL).Post().GetJSONStatus(context.Background(), &v)
+	if err != nil || code != http.StatusCreated || v.ID != 5 {
+		t.Errorf("got %d, %+v, %v", code, v, err)
+	}
+
+	code, err = New(srv.Client(), nil).URL(srv.URL).GetJSONStatus(context.Background(), &v)
+
+	var se *StatusError
+	if code != http.StatusNotFound || !errors.As(err, &se) {
+		t.Errorf("got %d, %v", code, err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.txt", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		start, end int64
+		want       string
+	}{
+		{2, 5, "2345"},
+		{7, -1, "789"},
+	} {
+		code, body, err := New(srv.Client(), nil).URL(srv.URL).Range(tt.start, tt.end).GetBodyStatus(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != http.StatusPartialContent || body != tt.want {
+			t.Errorf("range %d-%d: got %d %q", tt.start, tt.end, code, body)
+		}
+	}
+}
+
+func TestTokenScheme(t *testing.T) {
+	var auth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).TokenScheme("Token", "abc123").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if auth != "Token abc123" {
+		t.Errorf("got %q", auth)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Token("abc123").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if auth != "Bearer abc123" {
+		t.Errorf("got %q", auth)
+	}
+}
+
+func TestSetStripUserAgent(t *testing.T) {
+	var ua string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.UserAgent()
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(ua, "Go-http-client") {
+		t.Errorf("expected default User-Agent, got %q", ua)
+	}
+
+	SetStripUserAgent(true)
+	defer SetStripUserAgent(false)
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ua != "" {
+		t.Errorf("got User-Agent %q", ua)
+	}
+}
+
+func TestRefreshOn401(t *testing.T) {
+	var (
+		auths []string
+		body  string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer srv.Close()
+
+	refreshed := 0
+
+	r := New(srv.Client(), nil).URL(srv.URL).Post().Token("old").Body(strings.NewReader("data")).
+		RefreshOn401(func(ctx context.Context) (string, error) {
+			refreshed++
+
+			return "fresh", nil
+		})
+
+	if _, err := r.GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshed != 1 || !slices.Equal(auths, []string{"Bearer old", "Bearer fresh"}) || body != "data" {
+		t.Errorf("refreshed %d times, auth %v, body %q", refreshed, auths, body)
+	}
+
+	if r.token != "fresh" {
+		t.Errorf("token was not updated")
+	}
+}
+
+func TestLastHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "42")
+	}))
+	defer srv.Close()
+
+	r := New(srv.Client(), nil).URL(srv.URL)
+
+	if r.LastHeaders() != nil {
+		t.Error("expected no headers before the call")
+	}
+
+	if _, err := r.GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	h := r.LastHeaders()
+	if h.Get("X-RateLimit-Remaining") != "42" {
+		t.Errorf("got headers %v", h)
+	}
+
+	h.Set("X-RateLimit-Remaining", "0")
+
+	if r.LastHeaders().Get("X-RateLimit-Remaining") != "42" {
+		t.Error("returned headers are not a copy")
+	}
+}
+
+func TestPostJSONOK(t *testing.T) {
+	var (
+		method, ct string
+		got        map[string]any
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, ct = r.Method, r.Header.Get("Content-Type")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("ignored"))
+	}))
+	defer srv.Close()
+
+	req := New(srv.Client(), nil).URL(srv.URL)
+
+	if err := req.PostJSONOK(context.Background(), map[string]any{"event": "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPost || ct != "application/json" || got["event"] != "x" {
+		t.Errorf("server got %s %q %v", method, ct, got)
+	}
+
+	if req.method != http.MethodGet || req.body != nil || len(req.headers) != 0 {
+		t.Errorf("request is changed: %s %v %v", req.method, req.body, req.headers)
+	}
+
+	for path, code := range map[string]int{"/fail": http.StatusInternalServerError, "/not-modified": http.StatusNotModified} {
+		var se *StatusError
+
+		if err := New(srv.Client(), nil).URL(srv.URL+path).PostJSONOK(context.Background(), 1); !errors.As(err, &se) || se.Code != code {
+			t.Errorf("%s: expected StatusError, got %v", path, err)
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	base, call := new(bytes.Buffer), new(bytes.Buffer)
+
+	r := New(srv.Client(), testLogger(base)).URL(srv.URL).WithLogger(testLogger(call).With("job", "j1")).WithLogger(nil)
+
+	if _, err := r.GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if base.Len() != 0 {
+		t.Errorf("base logger was used: %s", base)
+	}
+
+	if !strings.Contains(call.String(), "job=j1") {
+		t.Errorf("got log %q", call)
+	}
+}
+
+func TestOrderedArgs(t *testing.T) {
+	var query string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.Client(), nil).URL(srv.URL+"?v=1").
+		OrderedArgs([2]string{"z", "last first"}, [2]string{"a", "b&c"}).
+		OrderedArgs([2]string{"m", "3"}).
+		GetBody(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query != "v=1&z=last+first&a=b%26c&m=3" {
+		t.Errorf("got query %q", query)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	var hits int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	built := false
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).Before(func(*http.Request) error {
+		built = true
+
+		return nil
+	}).GetBody(ctx)
+
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), srv.URL) {
+		t.Errorf("got %v", err)
+	}
+
+	if hits != 0 || built {
+		t.Errorf("request was built or sent")
+	}
+}
+
+func TestAcceptGzip(t *testing.T) {
+	payload := strings.Repeat("compressible ", 100)
+
+	var ae string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ae = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte(payload))
+		_ = gz.Close()
+	}))
+	defer srv.Close()
+
+	res, err := New(srv.Client(), nil).URL(srv.URL).AddHeader("X-Other", "1").AcceptGzip().DoRes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if ae != "gzip" {
+		t.Errorf("server got Accept-Encoding %q", ae)
+	}
+
+	if string(b) != payload || res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("got %d bytes, encoding %q", len(b), res.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestAcceptGzipNoBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", "100")
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	size, _, _, err := New(srv.Client(), nil).URL(srv.URL).AcceptGzip().HeadInfo(context.Background())
+	if err != nil || size != 100 {
+		t.Errorf("head: got %d, %v", size, err)
+	}
+
+	if b, err := New(srv.Client(), nil).URL(srv.URL).AcceptGzip().GetBody(context.Background()); err != nil || len(b) != 0 {
+		t.Errorf("no content: got %q, %v", b, err)
+	}
+}
+
+func TestChunkedBody(t *testing.T) {
+	got := make(chan string, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TransferEncoding) == 0 || r.TransferEncoding[0] != "chunked" {
+			t.Errorf("transfer encoding is %v", r.TransferEncoding)
+		}
+
+		buf := make([]byte, 5)
+
+		if _, err := io.ReadFull(r.Body, buf); err != nil {
+			t.Error(err)
+		}
+
+		got <- string(buf)
+
+		rest, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(rest)
+	}))
+	defer srv.Close()
+
+	// logging of the body must not buffer it
+	for _, logBody := range []int{0, 3} {
+		pr, pw := io.Pipe()
+
+		go func() {
+			_, _ = pw.Write([]byte("first"))
+
+			select {
+			case s := <-got:
+				if s != "first" {
+					t.Errorf("got %q", s)
+				}
+			case <-time.After(time.Second * 2):
+				t.Error("server got no data before the body is closed")
+			}
+
+			_, _ = pw.Write([]byte("second"))
+			pw.Close()
+		}()
+
+		buf := new(bytes.Buffer)
+
+		b, err := New(srv.Client(), testLogger(buf)).URL(srv.URL).Post().ChunkedBody(pr).LogBodies(logBody).GetBody(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != "second" {
+			t.Errorf("got %q", b)
+		}
+
+		if logged := strings.Contains(buf.String(), `request body \"fir\"`); logged != (logBody > 0) {
+			t.Errorf("log body %d: log %s", logBody, buf.String())
+		}
+	}
+}
+
+func TestGetBodyCookies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		http.SetCookie(w, &http.Cookie{Name: "lang", Value: "en", Path: "/"})
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	b, cookies, err := New(srv.Client(), nil).URL(srv.URL).GetBodyCookies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "ok" {
+		t.Errorf("got body %q", b)
+	}
+
+	if len(cookies) != 2 || cookies[0].Name != "session" || cookies[0].Value != "abc" || cookies[1].Name != "lang" || cookies[1].Value != "en" {
+		t.Errorf("got cookies %v", cookies)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") != `"v2"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Put().IfMatch(`"v2"`).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).Put().IfMatch(`"v1"`).GetBody(context.Background())
+
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 status error, got %v", err)
+	}
+}
+
+func TestLogBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("response " + string(b)))
+	}))
+	defer srv.Close()
+
+	buf := new(bytes.Buffer)
+
+	b, err := New(srv.Client(), testLogger(buf)).URL(srv.URL).Post().Body(strings.NewReader("request body")).LogBodies(7).GetBody(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "response request body" {
+		t.Errorf("got %q", b)
+	}
+
+	for _, want := range []string{`request body \"request\"`, `response body \"respons\"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %s in log %s", want, buf.String())
+		}
+	}
+	buf.Reset()
+
+	b, err = New(srv.Client(), testLogger(buf)).URL(srv.URL).Post().Body(io.MultiReader(strings.NewReader("streamed body"))).
+		ContentLength(13).LogBodies(8).GetBody(context.Background())
+	if err != nil || string(b) != "response streamed body" || !strings.Contains(buf.String(), `request body \"streamed\"`) {
+		t.Errorf("streamed: got %q, %v, log %s", b, err, buf.String())
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+
+	var dialed []string
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	b, err := New(srv.Client(), nil).URL("http://service.internal:8080/").DialContext(dial).GetBody(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "service.internal:8080" || !slices.Equal(dialed, []string{"service.internal:8080"}) {
+		t.Errorf("got host %q, dialed %v", b, dialed)
+	}
+}
+
+func TestPaginateJSON(t *testing.T) {
+	type item struct {
+		ID int `json:"id"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = w.Write([]byte(`{"items":[{"id":3}]}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"items":[{"id":1},{"id":2}],"next":"/items?page=2"}`))
+	}))
+	defer srv.Close()
+
+	extract := func(body []byte) ([]item, string, error) {
+		var page struct {
+			Items []item `json:"items"`
+			Next  string `json:"next"`
+		}
+
+		err := json.Unmarshal(body, &page)
+
+		return page.Items, page.Next, err
+	}
+
+	req := New(srv.Client(), nil).URL(srv.URL + "/items")
+
+	items, err := PaginateJSON(context.Background(), req, extract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(items) != "[{1} {2} {3}]" {
+		t.Errorf("got %v", items)
+	}
+
+	if req.url != srv.URL+"/items" {
+		t.Errorf("request url is changed to %s", req.url)
+	}
+
+	if items, err = PaginateJSON(context.Background(), req, extract); err != nil || len(items) != 3 {
+		t.Errorf("second call got %v, %v", items, err)
+	}
+}
+
+func TestIgnoreStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("maintenance"))
+	}))
+	defer srv.Close()
+
+	b, err := New(srv.Client(), nil).URL(srv.URL).IgnoreStatus().GetBody(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "maintenance" {
+		t.Errorf("got %q", b)
+	}
+}
+
+func TestPostNDJSONBatches(t *testing.T) {
+	var batches []int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("content type is %s", r.Header.Get("Content-Type"))
+		}
+
+		n := 0
+
+		for dec := json.NewDecoder(r.Body); dec.More(); n++ {
+			var v int
+			if err := dec.Decode(&v); err != nil {
+				t.Error(err)
+			}
+
+			if v == 13 {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}
+
+		batches = append(batches, n)
+	}))
+	defer srv.Close()
+
+	items := []any{1, 2, 3, 4, 5, 6, 7}
+	req := New(srv.Client(), nil).URL(srv.URL)
+
+	if err := req.PostNDJSONBatches(context.Background(), items, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.method != http.MethodGet || req.body != nil || len(req.headers) != 0 {
+		t.Errorf("request is changed: %s %v %v", req.method, req.body, req.headers)
+	}
+
+	if !slices.Equal(batches, []int{3, 3, 1}) {
+		t.Errorf("got batches %v", batches)
+	}
+
+	batches = nil
+	err := New(srv.Client(), nil).URL(srv.URL).PostNDJSONBatches(context.Background(), []any{1, 2, 13, 4, 5}, 2)
+
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusBadRequest || !strings.Contains(err.Error(), "batch 1") {
+		t.Errorf("expected status error for batch 1, got %v", err)
+	}
+
+	if len(batches) != 2 {
+		t.Errorf("got %d posts", len(batches))
+	}
+}
+
+func TestArgFunc(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer srv.Close()
+
+	n := 0
+	req := New(srv.Client(), nil).URL(srv.URL+"?a=1").ArgFunc("key", func() string {
+		n++
+
+		return fmt.Sprintf("k %d", n)
+	})
+
+	for _, want := range []string{"a=1&key=k+1", "a=1&key=k+2"} {
+		b, err := req.GetBody(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != want {
+			t.Errorf("got %q, want %q", b, want)
+		}
+	}
+}
+
+func TestRequireHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/missing" {
+			w.Header().Set("X-Verified", "true")
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).RequireHeader("x-verified", "true").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).RequireHeader("X-Verified", "").GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New(srv.Client(), nil).URL(srv.URL+"/missing").RequireHeader("X-Verified", "").GetBody(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected missing header error, got %v", err)
+	}
+
+	_, err = New(srv.Client(), nil).URL(srv.URL).RequireHeader("X-Verified", "yes").GetBody(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `"true"`) {
+		t.Errorf("expected mismatch error, got %v", err)
+	}
+}
+
+func TestTeeResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":1,"name":"test"}`))
+	}))
+	defer srv.Close()
+
+	buf := new(bytes.Buffer)
+
+	var v struct{ ID int }
+
+	if err := New(srv.Client(), nil).URL(srv.URL).TeeResponse(buf).GetJSON(context.Background(), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.ID != 1 || buf.String() != `{"id":1,"name":"test"}` {
+		t.Errorf("got %v, tee %q", v, buf.String())
+	}
+}
+
+func TestGetJSONMap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/array" {
+			_, _ = w.Write([]byte(`[1, 2]`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id": 12345678901234567890, "name": "test"}`))
+	}))
+	defer srv.Close()
+
+	m, err := New(srv.Client(), nil).URL(srv.URL).GetJSONMap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m["id"] != json.Number("12345678901234567890") || m["name"] != "test" {
+		t.Errorf("got %v", m)
+	}
+
+	_, err = New(srv.Client(), nil).URL(srv.URL + "/array").GetJSONMap(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "array") {
+		t.Errorf("expected not an object error, got %v", err)
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%d %v %s", r.ContentLength, r.TransferEncoding, b)
+	}))
+	defer srv.Close()
+
+	body := io.MultiReader(strings.NewReader("hello"))
+
+	b, err := New(srv.Client(), nil).URL(srv.URL).Post().Body(body).ContentLength(5).GetBody(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "5 [] hello" {
+		t.Errorf("got %q", b)
+	}
+}
+
+func TestGetValidated(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 0}`))
+	}))
+	defer srv.Close()
+
+	errNoID := errors.New("id is required")
+
+	var v struct{ ID int }
+
+	err := New(srv.Client(), nil).URL(srv.URL).GetValidated(context.Background(), &v, func(obj any) error {
+		if obj.(*struct{ ID int }).ID == 0 {
+			return errNoID
+		}
+
+		return nil
+	})
+
+	if !errors.Is(err, errNoID) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+}
+
+func TestGetBodyBuffer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pooled body"))
+	}))
+	defer srv.Close()
+
+	buf, release, err := New(srv.Client(), nil).URL(srv.URL).GetBodyBuffer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "pooled body" {
+		t.Errorf("got %q", buf.String())
+	}
+
+	release()
+
+	if buf.Len() != 0 {
+		t.Errorf("buffer is not reset, got %d bytes", buf.Len())
+	}
+}
+
+func BenchmarkGetBodyBuffer(b *testing.B) {
+	body := bytes.Repeat([]byte("x"), 32<<10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	req := New(srv.Client(), nil).URL(srv.URL)
+
+	b.Run("GetBody", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := req.GetBody(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("GetBodyBuffer", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			_, release, err := req.GetBodyBuffer(context.Background())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			release()
+		}
+	})
+}
+
+func TestJSONDecoder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 7}`))
+	}))
+	defer srv.Close()
+
+	calls := 0
+	dec := func(rd io.Reader, obj any) error {
+		calls++
+
+		return json.NewDecoder(rd).Decode(obj)
+	}
+
+	var v struct{ ID int }
+
+	if err := New(srv.Client(), nil).URL(srv.URL).JSONDecoder(dec).GetJSON(context.Background(), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 || v.ID != 7 {
+		t.Errorf("got %v after %d calls", v, calls)
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	var (
+		value     = "1"
+		version   = 1
+		conflicts = 1
+		puts      int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version)
+
+		if r.Method == http.MethodGet {
+			w.Header().Set("ETag", etag)
+			_, _ = w.Write([]byte(value))
+
+			return
+		}
+
+		puts++
+
+		if conflicts > 0 {
+			// someone else updated the resource
+			conflicts--
+			value, version = "10", version+1
+		}
+
+		if r.Header.Get("If-Match") != fmt.Sprintf(`"v%d"`, version) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+
+			return
+		}
+
+		b, _ := io.ReadAll(r.Body)
+		value, version = string(b), version+1
+	}))
+	defer srv.Close()
+
+	inc := func(cur []byte) (io.Reader, error) {
+		n, err := strconv.Atoi(string(cur))
+
+		return strings.NewReader(strconv.Itoa(n + 1)), err
+	}
+
+	req := New(srv.Client(), nil).URL(srv.URL)
+
+	if err := req.ConditionalUpdate(context.Background(), inc, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "11" || puts != 2 {
+		t.Errorf("got value %s after %d puts", value, puts)
+	}
+
+	if req.method != http.MethodGet || req.body != nil || req.headers["If-Match"] != "" {
+		t.Errorf("request is changed: %s %v %v", req.method, req.body, req.headers)
+	}
+
+	if err := req.ConditionalUpdate(context.Background(), inc, 0); err == nil || !strings.Contains(err.Error(), "max attempts") {
+		t.Errorf("expected invalid attempts error, got %v", err)
+	}
+
+	conflicts = 5
+
+	err := New(srv.Client(), nil).URL(srv.URL).ConditionalUpdate(context.Background(), inc, 2)
+
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var active, peak atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := active.Add(1); n > peak.Load() {
+			peak.Store(n)
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		active.Add(-1)
+
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	sem := make(chan struct{}, 1)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			path := "/"
+			if i%2 == 0 {
+				path = "/fail"
+			}
+
+			_, _ = New(srv.Client(), nil).URL(srv.URL + path).ConcurrencyLimit(sem).GetBody(context.Background())
+		}(i)
+	}
+
+	wg.Wait()
+
+	if peak.Load() != 1 {
+		t.Errorf("got %d concurrent requests", peak.Load())
+	}
+
+	if len(sem) != 0 {
+		t.Errorf("%d slots are not released", len(sem))
+	}
+}
+
+func TestGetJSONWithCount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nocount" {
+			w.Header().Set("X-Total-Count", "42")
+		}
+
+		_, _ = w.Write([]byte(`[{"id":1},{"id":2}]`))
+	}))
+	defer srv.Close()
+
+	var items []struct{ ID int }
+
+	n, err := New(srv.Client(), nil).URL(srv.URL).GetJSONWithCount(context.Background(), &items, "X-Total-Count")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 42 || len(items) != 2 || items[1].ID != 2 {
+		t.Errorf("got %d, %v", n, items)
+	}
+
+	n, err = New(srv.Client(), nil).URL(srv.URL+"/nocount").GetJSONWithCount(context.Background(), &items, "X-Total-Count")
+	if err != nil || n != -1 {
+		t.Errorf("got %d, %v", n, err)
+	}
+}
+
+type correlationKey struct{}
+
+func TestCorrelationFromContext(t *testing.T) {
+	var got []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Values("X-Correlation-Id")
+	}))
+	defer srv.Close()
+
+	req := New(srv.Client(), nil).URL(srv.URL).CorrelationFromContext(correlationKey{}, "X-Correlation-Id")
+
+	ctx := context.WithValue(context.Background(), correlationKey{}, "abc-123")
+
+	if _, err := req.GetBody(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(got, []string{"abc-123"}) {
+		t.Errorf("got %v", got)
+	}
+
+	if _, err := req.GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 0 {
+		t.Errorf("header is set without context value: %v", got)
+	}
+}
+
+func TestAcceptContentTypes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/portal" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<html>login</html>"))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "Application/JSON; charset=utf-8")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var v map[string]any
+
+	if err := New(srv.Client(), nil).URL(srv.URL).AcceptContentTypes("application/json").GetJSON(context.Background(), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	err := New(srv.Client(), nil).URL(srv.URL+"/portal").AcceptContentTypes("application/json").GetJSON(context.Background(), &v)
+	if err == nil || !strings.Contains(err.Error(), "text/html") {
+		t.Errorf("expected content type error, got %v", err)
+	}
+}
+
+func TestGetEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte(`{"data": {"id": 5}, "error": null}`))
+		case "/empty":
+			_, _ = w.Write([]byte(`{"data": {"id": 6}, "error": ""}`))
+		case "/false":
+			_, _ = w.Write([]byte(`{"data": {"id": 7}, "error": false}`))
+		case "/string":
+			_, _ = w.Write([]byte(`{"error": "not allowed"}`))
+		default:
+			_, _ = w.Write([]byte(`{"data": null, "error": {"code": 7, "message": "bad input"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	type item struct{ ID int }
+
+	for path, want := range map[string]int{"/ok": 5, "/empty": 6, "/false": 7} {
+		v, err := GetEnvelope[item](context.Background(), New(srv.Client(), nil).URL(srv.URL+path))
+		if err != nil || v.ID != want {
+			t.Errorf("%s: got %v, %v", path, v, err)
+		}
+	}
+
+	for path, want := range map[string]string{"/string": "not allowed", "/object": "bad input"} {
+		_, err := GetEnvelope[item](context.Background(), New(srv.Client(), nil).URL(srv.URL+path))
+
+		var ee *EnvelopeError
+		if !errors.As(err, &ee) || ee.Message != want {
+			t.Errorf("%s: expected envelope error %q, got %v", path, want, err)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var got string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization") + " " + r.URL.Query().Get("api_key")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	buf := new(bytes.Buffer)
+
+	_, _ = New(srv.Client(), testLogger(buf)).URL(srv.URL).Token("secret-token").Args(map[string]string{"api_key": "secret-key", "q": "1"}).
+		Redact([]string{"authorization"}, []string{"api_key"}).LogBodies(10).GetBody(context.Background())
+
+	if got != "Bearer secret-token secret-key" {
+		t.Errorf("request is changed: %q", got)
+	}
+
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "Bearer ***") || !strings.Contains(buf.String(), "api_key=***&q=1") {
+		t.Errorf("secrets are not redacted: %s", buf.String())
+	}
+
+	buf.Reset()
+
+	_, err := New(srv.Client(), testLogger(buf)).URL("http://127.0.0.1:1/?z=1&api_key=secret-key").Redact(nil, []string{"api_key"}).GetBody(context.Background())
+
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "error") {
+		t.Errorf("secrets are not redacted in error: %s", buf.String())
+	}
+
+	if err == nil || strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "?z=1&api_key=***") {
+		t.Errorf("secret in returned error: %v", err)
+	}
+
+	buf.Reset()
+
+	_, _ = New(srv.Client(), testLogger(buf)).URL(srv.URL).Token("secret-token").CookieHeader("sid=secret-sid").
+		AddHeader("X-Api-Key", "secret-key").Redact([]string{"X-Api-Key"}, nil).LogBodies(10).GetBody(context.Background())
+
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "request headers") {
+		t.Errorf("secret headers are logged: %s", buf.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = New(srv.Client(), nil).URL(srv.URL+"?api_key=secret-key").Redact(nil, []string{"api_key"}).GetBody(ctx)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("secret in error: %v", err)
+	}
+}
+
+func TestHeadInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method is %s", r.Method)
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Length", "1048576")
+
+		if r.URL.Path == "/ranges" {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+	}))
+	defer srv.Close()
+
+	req := New(srv.Client(), nil).URL(srv.URL + "/ranges")
+
+	size, ct, ranges, err := req.HeadInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != 1048576 || ct != "application/zip" || !ranges || req.method != http.MethodGet {
+		t.Errorf("got %d %s %v, method %s", size, ct, ranges, req.method)
+	}
+
+	if _, _, ranges, err := New(srv.Client(), nil).URL(srv.URL).HeadInfo(context.Background()); err != nil || ranges {
+		t.Errorf("got ranges %v, %v", ranges, err)
+	}
+}
+
+func TestPrivateTransportConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: &http.Transport{}}
+	dial := (&net.Dialer{}).DialContext
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		if _, err := New(c, nil).URL(srv.URL).DialContext(dial).GetBody(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var n int
+
+	for start := time.Now(); time.Since(start) < time.Second*2; time.Sleep(time.Millisecond * 20) {
+		if n = runtime.NumGoroutine(); n <= before+5 {
+			return
+		}
+	}
+
+	t.Errorf("%d goroutines left after requests, %d before", n, before)
+}
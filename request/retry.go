@@ -0,0 +1,182 @@
+package request
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultRetryDelay = time.Millisecond * 500
+
+// BackoffStrategy returns the delay before the next try after attempt failed. Attempts start from 1.
+type BackoffStrategy func(attempt int) time.Duration
+
+// Retry makes the request to be resent up to n more times on transport errors, 5xx and 429 statuses.
+// Request body must be replayable, e.g. bytes.Reader or strings.Reader, otherwise the request is not retried.
+// Retry-After of 429 and 503 responses is used as the delay instead of the backoff one.
+func (r *Request) Retry(n int) *Request {
+	r.retries = n
+
+	return r
+}
+
+// RetryBackoff sets delays between retries. Default is a flat half second.
+func (r *Request) RetryBackoff(strategy BackoffStrategy) *Request {
+	r.backoff = strategy
+
+	return r
+}
+
+// RetryBudget stops retrying when the time spent since the first try plus the next delay, Retry-After one too, exceeds d.
+func (r *Request) RetryBudget(d time.Duration) *Request {
+	r.budget = d
+
+	return r
+}
+
+// RetryIdempotentOnly limits retries to GET, HEAD, PUT, DELETE and OPTIONS requests, or requests with Idempotency-Key header.
+func (r *Request) RetryIdempotentOnly() *Request {
+	r.idemOnly = true
+
+	return r
+}
+
+// ExponentialJitter returns "full jitter" strategy: a random delay between zero and base * 2^(attempt-1), capped at max.
+func ExponentialJitter(base, max time.Duration) BackoffStrategy {
+	return exponentialJitter(base, max, rand.Float64)
+}
+
+func exponentialJitter(base, max time.Duration, rnd func() float64) BackoffStrategy {
+	return func(attempt int) time.Duration {
+		if attempt < 1 {
+			attempt = 1
+		}
+
+		d := max
+
+		if attempt < 63 {
+			if b := base << (attempt - 1); b > 0 && b < max {
+				d = b
+			}
+		}
+
+		return time.Duration(rnd() * float64(d))
+	}
+}
+
+// OnRetry sets a hook called before every retry with the number of the retry, the status of the failed attempt
+// (0 for transport errors), its error and the delay before the retry.
+func (r *Request) OnRetry(fn func(attempt int, status int, err error, nextDelay time.Duration)) *Request {
+	r.onRetry = fn
+
+	return r
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil && res == nil {
+		return true
+	}
+
+	return res != nil && (res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests)
+}
+
+// retryAfter returns the delay from Retry-After header of 429 and 503 responses, in seconds or as http date.
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res == nil || (res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	v := strings.TrimSpace(res.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 {
+			return 0, false
+		}
+
+		return time.Duration(n) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+
+	return 0, true
+}
+
+// sendRetry sends the request, retrying it as configured.
+func (r *Request) sendRetry(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := r.send(req)
+
+	if r.idemOnly && !idempotent(req) {
+		return res, err
+	}
+
+	for attempt := 1; attempt <= r.retries && shouldRetry(res, err); attempt++ {
+		next, err1 := replay(req)
+		if err1 != nil {
+			break
+		}
+
+		delay := defaultRetryDelay
+
+		if r.backoff != nil {
+			delay = r.backoff(attempt)
+		}
+
+		if d, ok := retryAfter(res, time.Now()); ok {
+			delay = d
+		}
+
+		if r.budget > 0 && time.Since(start)+delay > r.budget {
+			break
+		}
+
+		if r.onRetry != nil {
+			status := 0
+			if res != nil {
+				status = res.StatusCode
+			}
+
+			r.onRetry(attempt, status, err, delay)
+		}
+
+		if res != nil {
+			res.Body.Close()
+		}
+
+		t := time.NewTimer(delay)
+
+		select {
+		case <-req.Context().Done():
+			t.Stop()
+
+			return nil, req.Context().Err()
+		case <-t.C:
+		}
+
+		req = next
+		res, err = r.send(req)
+	}
+
+	return res, err
+}
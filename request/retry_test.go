@@ -0,0 +1,232 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExponentialJitter(t *testing.T) {
+	base, max := time.Millisecond*10, time.Millisecond*300
+	strategy := exponentialJitter(base, max, rand.New(rand.NewSource(42)).Float64)
+
+	var prev time.Duration
+
+	for attempt := 1; attempt <= 8; attempt++ {
+		limit := min(base<<(attempt-1), max)
+
+		var sum time.Duration
+
+		for i := 0; i < 1000; i++ {
+			d := strategy(attempt)
+
+			if d < 0 || d > limit {
+				t.Fatalf("attempt %d: delay %s out of [0, %s]", attempt, d, limit)
+			}
+
+			sum += d
+		}
+
+		avg := sum / 1000
+
+		if limit < max && avg <= prev {
+			t.Errorf("attempt %d: average delay %s did not grow from %s", attempt, avg, prev)
+		}
+
+		prev = avg
+	}
+
+	if d := strategy(1000); d < 0 || d > max {
+		t.Errorf("delay %s for big attempt", d)
+	}
+
+	for _, attempt := range []int{0, -1, -100} {
+		if d := strategy(attempt); d < 0 || d > base {
+			t.Errorf("delay %s for attempt %d", d, attempt)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var attempts []int
+
+	b, err := New(srv.Client(), nil).URL(srv.URL).
+		Post().
+		Body(strings.NewReader("data")).
+		Retry(3).
+		RetryBackoff(func(attempt int) time.Duration {
+			attempts = append(attempts, attempt)
+
+			return time.Millisecond
+		}).
+		GetBody(context.Background())
+
+	if err != nil || string(b) != "ok" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+
+	if hits.Load() != 3 || len(attempts) != 2 || attempts[1] != 2 {
+		t.Errorf("got %d hits, attempts %v", hits.Load(), attempts)
+	}
+}
+
+func TestRetryIdempotentOnly(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	noDelay := func(int) time.Duration { return 0 }
+
+	tests := []struct {
+		name  string
+		req   *Request
+		tries int32
+	}{
+		{"post", New(srv.Client(), nil).Post(), 1},
+		{"post with key", New(srv.Client(), nil).Post().AddHeader("Idempotency-Key", "k1"), 3},
+		{"get", New(srv.Client(), nil), 3},
+	}
+
+	for _, tt := range tests {
+		hits.Store(0)
+
+		_, _ = tt.req.URL(srv.URL).Retry(2).RetryBackoff(noDelay).RetryIdempotentOnly().GetBody(context.Background())
+
+		if n := hits.Load(); n != tt.tries {
+			t.Errorf("%s: got %d tries, want %d", tt.name, n, tt.tries)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).
+		Retry(10).
+		RetryBackoff(func(int) time.Duration { return time.Millisecond * 40 }).
+		RetryBudget(time.Millisecond * 100).
+		GetBody(context.Background())
+
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if n := hits.Load(); n < 2 || n > 3 {
+		t.Errorf("got %d tries", n)
+	}
+
+	if d := time.Since(start); d > time.Millisecond*150 {
+		t.Errorf("retries took %s", d)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		status int
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{http.StatusTooManyRequests, "3", time.Second * 3, true},
+		{http.StatusServiceUnavailable, now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{http.StatusServiceUnavailable, now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{http.StatusTooManyRequests, "-1", 0, false},
+		{http.StatusTooManyRequests, "soon", 0, false},
+		{http.StatusInternalServerError, "3", 0, false},
+	} {
+		res := &http.Response{StatusCode: tt.status, Header: http.Header{"Retry-After": {tt.header}}}
+
+		if d, ok := retryAfter(res, now); d != tt.want || ok != tt.ok {
+			t.Errorf("%d %q: got %s, %v", tt.status, tt.header, d, ok)
+		}
+	}
+
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.Header().Set("Retry-After", r.URL.Query().Get("after"))
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	// Retry-After replaces the backoff delay
+	if _, err := New(srv.Client(), nil).URL(srv.URL).Args(map[string]string{"after": "0"}).Retry(1).
+		RetryBackoff(func(int) time.Duration { return time.Minute }).GetBody(context.Background()); err != nil || hits.Load() != 2 {
+		t.Errorf("got %d tries, %v", hits.Load(), err)
+	}
+
+	hits.Store(0)
+	start := time.Now()
+
+	// the wait would exceed the budget, so the request is not retried
+	_, err := New(srv.Client(), nil).URL(srv.URL).Args(map[string]string{"after": "2"}).Retry(3).
+		RetryBudget(time.Second).GetBody(context.Background())
+
+	if err == nil || hits.Load() != 1 || time.Since(start) > time.Millisecond*500 {
+		t.Errorf("got %d tries in %s, %v", hits.Load(), time.Since(start), err)
+	}
+}
+
+func TestOnRetry(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	var got []string
+
+	backoff := func(attempt int) time.Duration { return time.Millisecond * time.Duration(attempt) }
+
+	_, err := New(srv.Client(), nil).URL(srv.URL).Retry(3).RetryBackoff(backoff).
+		OnRetry(func(attempt, status int, err error, delay time.Duration) {
+			got = append(got, fmt.Sprintf("%d %d %v %s", attempt, status, err != nil, delay))
+		}).GetBody(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"1 503 true 1ms", "2 503 true 2ms"}; !slices.Equal(got, want) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SingleFlightGroup holds in-flight requests shared with Request.SingleFlight. The zero value is ready to use.
+type SingleFlightGroup struct {
+	mx    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	res  *http.Response
+	body []byte
+	err  error
+}
+
+// flightKey makes the key of the request from its method, url and all headers, so requests with different
+// credentials or cookies are never shared.
+func flightKey(req *http.Request) string {
+	var sb strings.Builder
+
+	sb.WriteString(req.Method + " " + req.URL.String() + "\n")
+
+	keys := make([]string, 0, len(req.Header))
+
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		sb.WriteString(k + ": " + strings.Join(req.Header[k], "\x00") + "\n")
+	}
+
+	return sb.String()
+}
+
+// do calls fn once for concurrent callers with the same key. A caller waits for the shared call only as long as
+// its ctx allows. If the shared call fails because the context of its caller is done, waiting callers try again.
+func (g *SingleFlightGroup) do(ctx context.Context, key string, fn func() (*http.Response, error)) (*http.Response, error) {
+	g.mx.Lock()
+
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mx.Unlock()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded) {
+			return g.do(ctx, key, fn)
+		}
+
+		return c.response(), c.err
+	}
+
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mx.Unlock()
+
+	c.res, c.err = fn()
+
+	if c.res != nil && c.res.Body != nil {
+		body, err := io.ReadAll(c.res.Body)
+		c.res.Body.Close()
+
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+
+		c.body = body
+	}
+
+	g.mx.Lock()
+	delete(g.calls, key)
+	g.mx.Unlock()
+
+	close(c.done)
+
+	return c.response(), c.err
+}
+
+func (c *flightCall) response() *http.Response {
+	if c.res == nil {
+		return nil
+	}
+
+	res := *c.res
+	res.Header = c.res.Header.Clone()
+	res.Body = io.NopCloser(bytes.NewReader(c.body))
+
+	return &res
+}
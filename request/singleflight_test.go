@@ -0,0 +1,172 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlight(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(time.Millisecond * 200)
+		_, _ = w.Write([]byte("shared"))
+	}))
+	defer srv.Close()
+
+	group := new(SingleFlightGroup)
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			b, err := New(srv.Client(), nil).URL(srv.URL).SingleFlight(group).GetBody(context.Background())
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if string(b) != "shared" {
+				t.Errorf("got body %q", b)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := hits.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestSingleFlightSkipsPost(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(time.Millisecond * 50)
+	}))
+	defer srv.Close()
+
+	group := new(SingleFlightGroup)
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := New(srv.Client(), nil).URL(srv.URL).Post().SingleFlight(group).GetBody(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := hits.Load(); n != 3 {
+		t.Errorf("handler ran %d times, want 3", n)
+	}
+}
+
+func TestSingleFlightKey(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(time.Millisecond * 100)
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	group := new(SingleFlightGroup)
+	wg := new(sync.WaitGroup)
+
+	for _, token := range []string{"alice", "bob", "alice", "bob"} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			b, err := New(srv.Client(), nil).URL(srv.URL).Token(token).SingleFlight(group).GetBody(context.Background())
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if string(b) != "Bearer "+token {
+				t.Errorf("%s got body %q", token, b)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := hits.Load(); n != 2 {
+		t.Errorf("handler ran %d times, want 2", n)
+	}
+}
+
+func TestSingleFlightLeaderCancel(t *testing.T) {
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+
+		select {
+		case <-time.After(time.Millisecond * 100):
+		case <-r.Context().Done():
+		}
+
+		_, _ = w.Write([]byte("shared"))
+	}))
+	defer srv.Close()
+
+	group := new(SingleFlightGroup)
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+
+	go func() {
+		_, err := New(srv.Client(), nil).URL(srv.URL).SingleFlight(group).GetBody(ctx)
+		leader <- err
+	}()
+
+	for hits.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	follower := make(chan error)
+
+	go func() {
+		b, err := New(srv.Client(), nil).URL(srv.URL).SingleFlight(group).GetBody(context.Background())
+		if err == nil && string(b) != "shared" {
+			err = errors.New("got body " + string(b))
+		}
+
+		follower <- err
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader: expected context.Canceled, got %v", err)
+	}
+
+	if err := <-follower; err != nil {
+		t.Errorf("follower failed: %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package request
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"time"
+)
+
+// StreamJSON decodes a stream of json values (e.g. newline delimited json) from the response body and calls fn for each one.
+// Values are decoded only when fn returns, so a slow fn slows reading down. Context is checked between values.
+func (r *Request) StreamJSON(ctx context.Context, fn func(raw json.RawMessage) error) error {
+	body, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var raw json.RawMessage
+
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return streamErr(ctx, err)
+		}
+
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// StreamJSONArray calls fn for every element of the top level json array in the response body.
+func (r *Request) StreamJSONArray(ctx context.Context, fn func(raw json.RawMessage) error) error {
+	body, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+
+	if t, err := dec.Token(); err != nil {
+		return streamErr(ctx, err)
+	} else if t != json.Delim('[') {
+		return fmt.Errorf("expected json array, got %v", t)
+	}
+
+	for dec.More() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var raw json.RawMessage
+
+		if err := dec.Decode(&raw); err != nil {
+			return streamErr(ctx, err)
+		}
+
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+
+	_, err = dec.Token()
+
+	return streamErr(ctx, err)
+}
+
+// streamErr prefers context error, as read errors after cancel are just the consequence of it.
+func streamErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// StreamSSE reads text/event-stream response and calls fn for every event. Multi-line data is joined with "\n",
+// events without type are reported as "message". Context is checked between events.
+func (r *Request) StreamSSE(ctx context.Context, fn func(event, data string) error) error {
+	body, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	var (
+		event string
+		data  []string
+	)
+
+	sc := r.scanner(body)
+
+	for sc.Scan() {
+		line := sc.Text()
+
+		if line == "" {
+			if len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+
+				if err := fn(event, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+
+			event, data = "", nil
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		name, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch name {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	return streamErr(ctx, r.scanErr(sc))
+}
+
+// MaxLineSize sets the longest line StreamLines and StreamSSE accept. Default is 64 KiB.
+func (r *Request) MaxLineSize(n int) *Request {
+	r.maxLine = n
+
+	return r
+}
+
+// StreamLines calls fn for every line of the response body, without line endings. Context is checked between lines.
+func (r *Request) StreamLines(ctx context.Context, fn func(line string) error) error {
+	body, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	sc := r.scanner(body)
+
+	for sc.Scan() {
+		if err := fn(sc.Text()); err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	return streamErr(ctx, r.scanErr(sc))
+}
+
+// CSVComma sets field delimiter for StreamCSV, default is ','.
+func (r *Request) CSVComma(comma rune) *Request {
+	r.csvComma = comma
+
+	return r
+}
+
+// CSVSkipHeader makes StreamCSV skip the first record.
+func (r *Request) CSVSkipHeader() *Request {
+	r.csvSkip = true
+
+	return r
+}
+
+// StreamCSV calls fn for every csv record of the response body. Context is checked between records.
+func (r *Request) StreamCSV(ctx context.Context, fn func(record []string) error) error {
+	body, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	cr := csv.NewReader(body)
+
+	if r.csvComma != 0 {
+		cr.Comma = r.csvComma
+	}
+
+	for skip := r.csvSkip; ; skip = false {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return streamErr(ctx, err)
+		}
+
+		if skip {
+			continue
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Request) scanner(rd io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(rd)
+
+	if r.maxLine > 0 {
+		sc.Buffer(make([]byte, 0, min(r.maxLine, bufio.MaxScanTokenSize)), r.maxLine)
+	}
+
+	return sc
+}
+
+func (r *Request) scanErr(sc *bufio.Scanner) error {
+	err := sc.Err()
+	if !errors.Is(err, bufio.ErrTooLong) {
+		return err
+	}
+
+	size := r.maxLine
+	if size <= 0 {
+		size = bufio.MaxScanTokenSize
+	}
+
+	return fmt.Errorf("line is longer than %d bytes: %w", size, err)
+}
+
+// GetMultipart calls fn for every part of multipart response, e.g. multipart/mixed.
+func (r *Request) GetMultipart(ctx context.Context, fn func(part *multipart.Part) error) error {
+	res, err := r.DoRes(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	mt, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", res.Header.Get("Content-Type"), err)
+	}
+
+	if !strings.HasPrefix(mt, "multipart/") || params["boundary"] == "" {
+		return fmt.Errorf("no multipart boundary in content type %q", res.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(res.Body, params["boundary"])
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return streamErr(ctx, err)
+		}
+
+		err = fn(part)
+		part.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var ErrStreamIdle = errors.New("no data received within stream idle timeout")
+
+// StreamIdleTimeout cancels the request if no response bytes arrive for d, reads then fail with ErrStreamIdle.
+func (r *Request) StreamIdleTimeout(d time.Duration) *Request {
+	r.idle = d
+
+	return r
+}
+
+type idleTimer struct {
+	ctx context.Context
+	t   *time.Timer
+	d   time.Duration
+}
+
+func withIdleTimeout(ctx context.Context, d time.Duration) (context.Context, *idleTimer, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	it := &idleTimer{ctx: ctx, d: d}
+	it.t = time.AfterFunc(d, func() { cancel(ErrStreamIdle) })
+
+	return ctx, it, func() {
+		it.t.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+func (it *idleTimer) err(err error) error {
+	if err != nil && errors.Is(context.Cause(it.ctx), ErrStreamIdle) {
+		return ErrStreamIdle
+	}
+
+	return err
+}
+
+type idleBody struct {
+	io.ReadCloser
+	it *idleTimer
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if n > 0 {
+		b.it.t.Reset(b.it.d)
+	}
+
+	return n, b.it.err(err)
+}
+
+var ErrBodyReadDeadline = errors.New("response body read deadline exceeded")
+
+// BodyReadDeadline limits reading of the response body to d after the response headers arrive, however steady the data is.
+// Reads after that fail with ErrBodyReadDeadline.
+func (r *Request) BodyReadDeadline(d time.Duration) *Request {
+	r.readDL = d
+
+	return r
+}
+
+type deadlineBody struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if err != nil && errors.Is(context.Cause(b.ctx), ErrBodyReadDeadline) {
+		return n, ErrBodyReadDeadline
+	}
+
+	return n, err
+}
+
+// FrameTrailer is the flag bit marking grpc-web trailer frames.
+const FrameTrailer byte = 0x80
+
+const maxFrameSize = 64 << 20
+
+// StreamFrames reads length prefixed frames (1 byte flag, 4 bytes big-endian length, payload) used by grpc-web
+// and calls fn for each one. Reading stops after a trailer frame, which has FrameTrailer bit set in the flag.
+func (r *Request) StreamFrames(ctx context.Context, fn func(flag byte, data []byte) error) error {
+	body, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	var hdr [5]byte
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(body, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return streamErr(ctx, fmt.Errorf("frame header: %w", err))
+		}
+
+		size := binary.BigEndian.Uint32(hdr[1:])
+		if size > maxFrameSize {
+			return fmt.Errorf("frame of %d bytes is too big", size)
+		}
+
+		data := make([]byte, size)
+
+		if _, err := io.ReadFull(body, data); err != nil {
+			return streamErr(ctx, fmt.Errorf("frame data: %w", err))
+		}
+
+		if err := fn(hdr[0], data); err != nil {
+			return err
+		}
+
+		if hdr[0]&FrameTrailer != 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package request
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"))
+	}))
+	defer srv.Close()
+
+	var ids []int
+
+	err := New(srv.Client(), nil).URL(srv.URL).StreamJSON(context.Background(), func(raw json.RawMessage) error {
+		var v struct{ ID int }
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+
+		ids = append(ids, v.ID)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Errorf("got %v", ids)
+	}
+}
+
+func TestStreamJSONArray(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id":1}, {"id":2}]`))
+	}))
+	defer srv.Close()
+
+	n := 0
+
+	err := New(srv.Client(), nil).URL(srv.URL).StreamJSONArray(context.Background(), func(raw json.RawMessage) error {
+		n++
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("got %d elements", n)
+	}
+}
+
+// endlessJSON streams json records until the client goes away.
+func endlessJSON(array bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if array {
+			_, _ = w.Write([]byte("["))
+		}
+
+		for i := 0; r.Context().Err() == nil; i++ {
+			if array && i > 0 {
+				_, _ = w.Write([]byte(","))
+			}
+
+			_, _ = fmt.Fprintf(w, "{\"id\":%d}\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+}
+
+func TestStreamJSONCancel(t *testing.T) {
+	for _, array := range []bool{false, true} {
+		srv := httptest.NewServer(endlessJSON(array))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		n := 0
+
+		fn := func(raw json.RawMessage) error {
+			if n++; n == 5 {
+				cancel()
+			}
+
+			return nil
+		}
+
+		start := time.Now()
+
+		var err error
+
+		if array {
+			err = New(srv.Client(), nil).URL(srv.URL).StreamJSONArray(ctx, fn)
+		} else {
+			err = New(srv.Client(), nil).URL(srv.URL).StreamJSON(ctx, fn)
+		}
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("array %v: expected context.Canceled, got %v", array, err)
+		}
+
+		if n != 5 {
+			t.Errorf("array %v: callback called %d times after cancel", array, n)
+		}
+
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("array %v: stream stopped after %s", array, d)
+		}
+
+		cancel()
+		srv.Close()
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(": comment\n\nevent: update\ndata: line1\ndata: line2\n\ndata:plain\r\n\r\nevent: lost\ndata: incomplete\n"))
+	}))
+	defer srv.Close()
+
+	var got []string
+
+	err := New(srv.Client(), nil).URL(srv.URL).StreamSSE(context.Background(), func(event, data string) error {
+		got = append(got, event+"="+data)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"update=line1\nline2", "message=plain"}; !slices.Equal(got, want) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStreamLines(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/long" {
+			_, _ = w.Write([]byte("short\n" + strings.Repeat("x", 100) + "\n"))
+
+			return
+		}
+
+		for i := 1; i <= 3; i++ {
+			_, _ = fmt.Fprintf(w, "line %d\r\n", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	var got []string
+
+	err := New(srv.Client(), nil).URL(srv.URL).StreamLines(context.Background(), func(line string) error {
+		got = append(got, line)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"line 1", "line 2", "line 3"}; !slices.Equal(got, want) {
+		t.Errorf("got %q", got)
+	}
+
+	got = nil
+
+	err = New(srv.Client(), nil).URL(srv.URL+"/long").MaxLineSize(50).StreamLines(context.Background(), func(line string) error {
+		got = append(got, line)
+
+		return nil
+	})
+
+	if !errors.Is(err, bufio.ErrTooLong) || !strings.Contains(err.Error(), "50 bytes") {
+		t.Errorf("expected line too long error, got %v", err)
+	}
+
+	if !slices.Equal(got, []string{"short"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestGetMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			w.Header().Set("Content-Type", "multipart/mixed")
+
+			return
+		}
+
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+
+		for i, ct := range []string{"application/json", "text/plain"} {
+			pw, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {ct}})
+			_, _ = fmt.Fprintf(pw, "part %d", i)
+		}
+
+		_ = mw.Close()
+	}))
+	defer srv.Close()
+
+	var got []string
+
+	err := New(srv.Client(), nil).URL(srv.URL).GetMultipart(context.Background(), func(part *multipart.Part) error {
+		b, err := io.ReadAll(part)
+		got = append(got, part.Header.Get("Content-Type")+": "+string(b))
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"application/json: part 0", "text/plain: part 1"}; !slices.Equal(got, want) {
+		t.Errorf("got %q", got)
+	}
+
+	err = New(srv.Client(), nil).URL(srv.URL+"/plain").GetMultipart(context.Background(), func(part *multipart.Part) error {
+		return nil
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "boundary") {
+		t.Errorf("expected missing boundary error, got %v", err)
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			_, _ = fmt.Fprintf(w, "tick %d\n", i)
+			w.(http.Flusher).Flush()
+
+			if r.URL.Path == "/pause" && i == 1 {
+				select {
+				case <-time.After(time.Second):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			time.Sleep(time.Millisecond * 20)
+		}
+	}))
+	defer srv.Close()
+
+	n := 0
+	count := func(string) error { n++; return nil }
+
+	if err := New(srv.Client(), nil).URL(srv.URL).StreamIdleTimeout(time.Millisecond*200).StreamLines(context.Background(), count); err != nil {
+		t.Fatalf("steady stream failed: %v", err)
+	}
+
+	if n != 5 {
+		t.Errorf("got %d lines", n)
+	}
+
+	n = 0
+	start := time.Now()
+
+	err := New(srv.Client(), nil).URL(srv.URL+"/pause").StreamIdleTimeout(time.Millisecond*200).StreamLines(context.Background(), count)
+	if !errors.Is(err, ErrStreamIdle) {
+		t.Errorf("expected ErrStreamIdle, got %v", err)
+	}
+
+	if d := time.Since(start); n != 2 || d > time.Millisecond*800 {
+		t.Errorf("got %d lines in %s", n, d)
+	}
+}
+
+func TestStreamFrames(t *testing.T) {
+	frame := func(flag byte, data string) []byte {
+		b := []byte{flag, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(len(data)))
+
+		return append(b, data...)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(frame(0, "first"))
+		_, _ = w.Write(frame(0, ""))
+		_, _ = w.Write(frame(FrameTrailer, "grpc-status: 0\r\n"))
+		_, _ = w.Write(frame(0, "after trailer"))
+	}))
+	defer srv.Close()
+
+	var (
+		msgs     []string
+		trailers []string
+	)
+
+	err := New(srv.Client(), nil).URL(srv.URL).StreamFrames(context.Background(), func(flag byte, data []byte) error {
+		if flag&FrameTrailer != 0 {
+			trailers = append(trailers, string(data))
+		} else {
+			msgs = append(msgs, string(data))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(msgs, []string{"first", ""}) || !slices.Equal(trailers, []string{"grpc-status: 0\r\n"}) {
+		t.Errorf("got messages %q, trailers %q", msgs, trailers)
+	}
+}
+
+func TestStreamFramesTruncated(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte{0, 0, 0, 0, 10, 'a', 'b'})
+	}))
+	defer srv.Close()
+
+	err := New(srv.Client(), nil).URL(srv.URL).StreamFrames(context.Background(), func(flag byte, data []byte) error {
+		return nil
+	})
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+}
+
+func TestStreamCSV(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/semicolon" {
+			_, _ = w.Write([]byte("id;name\n1;\"a;b\"\n"))
+
+			return
+		}
+
+		_, _ = w.Write([]byte("id,name\n1,first\n2,second\n"))
+	}))
+	defer srv.Close()
+
+	var got []string
+
+	fn := func(rec []string) error {
+		got = append(got, strings.Join(rec, "|"))
+
+		return nil
+	}
+
+	if err := New(srv.Client(), nil).URL(srv.URL).StreamCSV(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"id|name", "1|first", "2|second"}; !slices.Equal(got, want) {
+		t.Errorf("got %q", got)
+	}
+
+	got = nil
+
+	if err := New(srv.Client(), nil).URL(srv.URL+"/semicolon").CSVComma(';').CSVSkipHeader().StreamCSV(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"1|a;b"}; !slices.Equal(got, want) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestBodyReadDeadline(t *testing.T) {
+	srv := httptest.NewServer(endlessJSON(false))
+	defer srv.Close()
+
+	n := 0
+	start := time.Now()
+
+	err := New(srv.Client(), nil).URL(srv.URL).BodyReadDeadline(time.Millisecond*200).StreamLines(context.Background(), func(string) error {
+		n++
+
+		return nil
+	})
+
+	if !errors.Is(err, ErrBodyReadDeadline) {
+		t.Errorf("expected ErrBodyReadDeadline, got %v", err)
+	}
+
+	if d := time.Since(start); n == 0 || d < time.Millisecond*200 || d > time.Millisecond*800 {
+		t.Errorf("got %d lines in %s", n, d)
+	}
+}
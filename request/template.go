@@ -0,0 +1,98 @@
+package request
+
+import (
+	"log/slog"
+	"maps"
+	"net/http"
+)
+
+// Template keeps common request settings. Template methods return a changed copy and never modify the template,
+// so one template can be shared between goroutines.
+type Template struct {
+	url     string
+	method  string
+	token   string
+	login   string
+	passw   string
+	headers map[string]string
+	args    map[string]string
+}
+
+func NewTemplate() *Template {
+	return &Template{method: http.MethodGet}
+}
+
+func (t *Template) URL(url string) *Template {
+	c := t.clone()
+	c.url = url
+
+	return c
+}
+
+func (t *Template) Method(method string) *Template {
+	c := t.clone()
+	c.method = method
+
+	return c
+}
+
+func (t *Template) Token(token string) *Template {
+	c := t.clone()
+	c.token = token
+
+	return c
+}
+
+func (t *Template) Auth(login, passw string) *Template {
+	c := t.clone()
+	c.login, c.passw = login, passw
+
+	return c
+}
+
+func (t *Template) AddHeader(k, v string) *Template {
+	c := t.clone()
+
+	if c.headers == nil {
+		c.headers = make(map[string]string)
+	}
+
+	c.headers[k] = v
+
+	return c
+}
+
+func (t *Template) AddArg(k, v string) *Template {
+	c := t.clone()
+
+	if c.args == nil {
+		c.args = make(map[string]string)
+	}
+
+	c.args[k] = v
+
+	return c
+}
+
+// New returns a request with template settings. The request doesn't share any state with the template.
+func (t *Template) New(c *http.Client, logger *slog.Logger) *Request {
+	r := New(c, logger).URL(t.url).Method(t.method).Token(t.token).Auth(t.login, t.passw)
+
+	if len(t.headers) > 0 {
+		r.Headers(maps.Clone(t.headers))
+	}
+
+	if len(t.args) > 0 {
+		r.Args(maps.Clone(t.args))
+	}
+
+	return r
+}
+
+func (t *Template) clone() *Template {
+	c := *t
+	c.headers = maps.Clone(t.headers)
+	c.args = maps.Clone(t.args)
+
+	return &c
+}
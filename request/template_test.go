@@ -0,0 +1,71 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tkn" || r.Header.Get("X-Base") != "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "%s %s %s", r.URL.Query().Get("v"), r.URL.Query().Get("n"), r.Header.Get("X-N"))
+	}))
+	defer srv.Close()
+
+	base := NewTemplate().URL(srv.URL).Token("tkn").AddHeader("X-Base", "1").AddArg("v", "2")
+
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			n := strconv.Itoa(i)
+
+			r := base.New(srv.Client(), nil).AddHeader("X-N", n)
+			r.args["n"] = n
+
+			b, err := r.GetBody(context.Background())
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if want := "2 " + n + " " + n; string(b) != want {
+				t.Errorf("got %q, want %q", b, want)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(base.headers) != 1 || len(base.args) != 1 {
+		t.Errorf("template was modified: %v %v", base.headers, base.args)
+	}
+}
+
+func TestTemplateImmutable(t *testing.T) {
+	base := NewTemplate().AddHeader("A", "1")
+	derived := base.AddHeader("B", "2").Method(http.MethodPost)
+
+	if len(base.headers) != 1 || base.method != http.MethodGet {
+		t.Errorf("base template changed: %+v", base)
+	}
+
+	if len(derived.headers) != 2 || derived.method != http.MethodPost {
+		t.Errorf("got derived %+v", derived)
+	}
+}
@@ -0,0 +1,84 @@
+package request
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ClientCert adds a client certificate for mutual TLS. The certificate is set on a copy of the client transport,
+// so it is used by this request only. The client transport must be *http.Transport, otherwise the request fails.
+func (r *Request) ClientCert(cert tls.Certificate) *Request {
+	cfg := r.tlsConfig()
+	cfg.Certificates = append(cfg.Certificates, cert)
+
+	return r
+}
+
+// PinCert makes the request trust only servers whose leaf certificate has one of the given sha-256 fingerprints.
+// Fingerprints are hex strings, colons are allowed. CA chain and host name are not verified then, the pin replaces them.
+// The client transport must be *http.Transport, otherwise the request fails.
+func (r *Request) PinCert(sha256hex ...string) *Request {
+	pins := make(map[string]bool, len(sha256hex))
+
+	for _, s := range sha256hex {
+		pins[strings.ToLower(strings.ReplaceAll(s, ":", ""))] = true
+	}
+
+	cfg := r.tlsConfig()
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate")
+		}
+
+		sum := sha256.Sum256(rawCerts[0])
+
+		if !pins[hex.EncodeToString(sum[:])] {
+			return errors.New("server certificate fingerprint doesn't match pinned ones")
+		}
+
+		return nil
+	}
+
+	return r
+}
+
+// WarnCertExpiry logs a warning when the server certificate expires within the given time. The request is not failed.
+// The client transport must be *http.Transport, otherwise the request fails.
+func (r *Request) WarnCertExpiry(within time.Duration) *Request {
+	cfg := r.tlsConfig()
+	prev := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) > 0 {
+			leaf := cs.PeerCertificates[0]
+
+			if left := time.Until(leaf.NotAfter); left < within {
+				r.logger.Warn(fmt.Sprintf("certificate of %s expires at %s, in %s", cs.ServerName, leaf.NotAfter.Format(time.RFC3339), left.Round(time.Second)))
+			}
+		}
+
+		if prev != nil {
+			return prev(cs)
+		}
+
+		return nil
+	}
+
+	return r
+}
+
+func (r *Request) tlsConfig() *tls.Config {
+	t := r.transport()
+
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = new(tls.Config)
+	}
+
+	return t.TLSClientConfig
+}
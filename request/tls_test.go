@@ -0,0 +1,162 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func selfSignedCert(t *testing.T, notAfter time.Time, usage x509.ExtKeyUsage) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		DNSNames:              []string{"localhost", "example.com"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
+
+func TestClientCert(t *testing.T) {
+	cert, leaf := selfSignedCert(t, time.Now().Add(time.Hour), x509.ExtKeyUsageClientAuth)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	var cn string
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cn = r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).GetBody(context.Background()); err == nil {
+		t.Fatal("expected error without client certificate")
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).ClientCert(cert).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if cn != "test" {
+		t.Errorf("server got client cert %q", cn)
+	}
+
+	if len(srv.Client().Transport.(*http.Transport).TLSClientConfig.Certificates) != 0 {
+		t.Error("client transport was modified")
+	}
+}
+
+func TestPinCert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	pin := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	if _, err := New(&http.Client{}, nil).URL(srv.URL).PinCert("00ff", pin).GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(&http.Client{}, nil).URL(srv.URL).PinCert(strings.Repeat("ab", 32)).GetBody(context.Background()); err == nil {
+		t.Error("expected error for wrong fingerprint")
+	}
+}
+
+func TestWarnCertExpiry(t *testing.T) {
+	cert, leaf := selfSignedCert(t, time.Now().Add(time.Hour*24), x509.ExtKeyUsageServerAuth)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	for _, tt := range []struct {
+		within time.Duration
+		warn   bool
+	}{
+		{time.Hour * 24 * 30, true},
+		{time.Hour, false},
+	} {
+		buf := new(bytes.Buffer)
+
+		if _, err := New(c, testLogger(buf)).URL(srv.URL).WarnCertExpiry(tt.within).GetBody(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if warn := strings.Contains(buf.String(), "level=WARN"); warn != tt.warn {
+			t.Errorf("within %s: got warning %v, log %q", tt.within, warn, buf)
+		}
+	}
+}
+
+func TestTransportNotCloned(t *testing.T) {
+	var hits int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: uaTransport{next: http.DefaultTransport}}
+
+	for name, fn := range map[string]func(*Request) *Request{
+		"client cert": func(r *Request) *Request { return r.ClientCert(tls.Certificate{}) },
+		"pin":         func(r *Request) *Request { return r.PinCert(strings.Repeat("ab", 32)) },
+		"expiry":      func(r *Request) *Request { return r.WarnCertExpiry(time.Hour) },
+		"dial":        func(r *Request) *Request { return r.DialContext((&net.Dialer{}).DialContext) },
+	} {
+		_, err := fn(New(c, nil).URL(srv.URL)).GetBody(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "request.uaTransport can't be cloned") {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+
+	if hits != 0 {
+		t.Errorf("server got %d requests", hits)
+	}
+}
@@ -0,0 +1,252 @@
+package request
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceExtractor returns W3C trace context values for the context, empty traceparent means no trace.
+type TraceExtractor func(ctx context.Context) (traceparent, tracestate string)
+
+var traceExtractor atomic.Pointer[TraceExtractor]
+
+// SetTraceExtractor sets the function used by InjectTraceContext, e.g. one built on otel propagators. Nil removes it.
+func SetTraceExtractor(fn TraceExtractor) {
+	if fn == nil {
+		traceExtractor.Store(nil)
+
+		return
+	}
+
+	traceExtractor.Store(&fn)
+}
+
+// InjectTraceContext sets traceparent and tracestate headers from the request context with the extractor
+// set by SetTraceExtractor. Nothing is set without extractor or trace.
+func (r *Request) InjectTraceContext() *Request {
+	r.trace = true
+
+	return r
+}
+
+func injectTraceContext(req *http.Request) {
+	fn := traceExtractor.Load()
+	if fn == nil {
+		return
+	}
+
+	parent, state := (*fn)(req.Context())
+	if parent == "" {
+		return
+	}
+
+	req.Header.Set("traceparent", parent)
+
+	if state != "" {
+		req.Header.Set("tracestate", state)
+	}
+}
+
+// ProbeResult describes the connection used by Probe.
+type ProbeResult struct {
+	StatusCode  int
+	RemoteAddr  string
+	Reused      bool
+	Protocol    string
+	TLSVersion  string
+	ConnectTime time.Duration
+	TLSTime     time.Duration
+	Total       time.Duration
+}
+
+// Probe sends HEAD request to the url and returns connection details. Connect and TLS times are zero for reused connections.
+func (r *Request) Probe(ctx context.Context) (*ProbeResult, error) {
+	var (
+		pr       ProbeResult
+		mx       sync.Mutex
+		dial     dialTimes
+		tlsStart time.Time
+		start    = time.Now()
+	)
+
+	// hooks are called from transport goroutines, ipv4 and ipv6 addresses may be dialed concurrently
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			dial.start(network, addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			if d, ok := dial.done(network, addr, err); ok {
+				pr.ConnectTime = d
+			}
+		},
+		TLSHandshakeStart: func() {
+			mx.Lock()
+			defer mx.Unlock()
+
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			if err == nil {
+				pr.TLSTime = time.Since(tlsStart)
+				pr.TLSVersion = tls.VersionName(cs.Version)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			pr.RemoteAddr = info.Conn.RemoteAddr().String()
+			pr.Reused = info.Reused
+		},
+	}
+
+	method := r.method
+	r.method = http.MethodHead
+
+	res, err := r.DoRes(httptrace.WithClientTrace(ctx, trace))
+
+	r.method = method
+
+	if res == nil {
+		return nil, err
+	}
+
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	mx.Lock()
+	defer mx.Unlock()
+
+	pr.StatusCode = res.StatusCode
+	pr.Protocol = res.Proto
+	pr.Total = time.Since(start)
+
+	if res.TLS != nil && pr.TLSVersion == "" {
+		pr.TLSVersion = tls.VersionName(res.TLS.Version)
+	}
+
+	p := pr
+
+	return &p, err
+}
+
+// dialTimes keeps start times of dials by address, the first successful dial is the connection one.
+type dialTimes struct {
+	starts map[string]time.Time
+	ok     bool
+}
+
+func (d *dialTimes) start(network, addr string) {
+	if d.starts == nil {
+		d.starts = make(map[string]time.Time)
+	}
+
+	d.starts[network+" "+addr] = time.Now()
+}
+
+// done returns the duration of the dial if it is the first successful one.
+func (d *dialTimes) done(network, addr string, err error) (time.Duration, bool) {
+	start, found := d.starts[network+" "+addr]
+	if err != nil || !found || d.ok {
+		return 0, false
+	}
+
+	d.ok = true
+
+	return time.Since(start), true
+}
+
+// Timings of a request. DNS, Connect and TLS are zero for reused connections, TTFB and Total are counted from the start
+// of the request, Total includes reading of the whole body.
+type Timings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration
+	Total   time.Duration
+}
+
+// GetBodyTimings is GetBody that also returns timings of the request.
+func (r *Request) GetBodyTimings(ctx context.Context) ([]byte, Timings, error) {
+	var (
+		t                  Timings
+		mx                 sync.Mutex
+		dial               dialTimes
+		dnsStart, tlsStart time.Time
+		start              = time.Now()
+	)
+
+	// hooks are called from transport goroutines, ipv4 and ipv6 addresses may be dialed concurrently
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			t.DNS = time.Since(dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			dial.start(network, addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			if d, ok := dial.done(network, addr, err); ok {
+				t.Connect = d
+			}
+		},
+		TLSHandshakeStart: func() {
+			mx.Lock()
+			defer mx.Unlock()
+
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			if err == nil {
+				t.TLS = time.Since(tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			mx.Lock()
+			defer mx.Unlock()
+
+			t.TTFB = time.Since(start)
+		},
+	}
+
+	b, err := r.GetBody(httptrace.WithClientTrace(ctx, trace))
+
+	mx.Lock()
+	defer mx.Unlock()
+
+	t.Total = time.Since(start)
+
+	return b, t, err
+}
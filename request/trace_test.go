@@ -0,0 +1,127 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	var method string
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+	defer srv.Close()
+
+	pr, err := New(srv.Client(), nil).URL(srv.URL).Probe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodHead {
+		t.Errorf("got method %s", method)
+	}
+
+	if pr.StatusCode != http.StatusOK || pr.RemoteAddr == "" || pr.Reused {
+		t.Errorf("got %+v", pr)
+	}
+
+	if pr.TLSVersion != "TLS 1.3" {
+		t.Errorf("got TLS version %q", pr.TLSVersion)
+	}
+
+	if pr.ConnectTime <= 0 || pr.TLSTime <= 0 || pr.Total < pr.TLSTime {
+		t.Errorf("got timings %+v", pr)
+	}
+}
+
+type traceKey struct{}
+
+func TestInjectTraceContext(t *testing.T) {
+	var got http.Header
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	SetTraceExtractor(func(ctx context.Context) (string, string) {
+		id, _ := ctx.Value(traceKey{}).(string)
+		if id == "" {
+			return "", ""
+		}
+
+		return "00-" + id + "-00f067aa0ba902b7-01", "vendor=1"
+	})
+	defer SetTraceExtractor(nil)
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := context.WithValue(context.Background(), traceKey{}, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).InjectTraceContext().GetBody(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Get("traceparent") != parent || got.Get("tracestate") != "vendor=1" {
+		t.Errorf("got headers %v", got)
+	}
+
+	if _, err := New(srv.Client(), nil).URL(srv.URL).InjectTraceContext().GetBody(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := got["Traceparent"]; ok {
+		t.Errorf("traceparent is set without trace: %v", got)
+	}
+}
+
+func TestGetBodyTimings(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 50)
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(time.Millisecond * 100)
+		_, _ = w.Write([]byte(" second"))
+	}))
+	defer srv.Close()
+
+	b, tm, err := New(srv.Client(), nil).URL(srv.URL).GetBodyTimings(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "first second" {
+		t.Errorf("got %q", b)
+	}
+
+	if tm.TTFB < time.Millisecond*50 || tm.Total-tm.TTFB < time.Millisecond*80 {
+		t.Errorf("got ttfb %s, total %s", tm.TTFB, tm.Total)
+	}
+
+	if tm.Connect == 0 || tm.TLS == 0 {
+		t.Errorf("no connect or tls time: %+v", tm)
+	}
+}
+
+func TestDialTimes(t *testing.T) {
+	var d dialTimes
+
+	d.start("tcp", "[::1]:80")
+	d.start("tcp", "127.0.0.1:80")
+
+	if _, ok := d.done("tcp", "[::1]:80", errors.New("refused")); ok {
+		t.Error("failed dial is counted")
+	}
+
+	if _, ok := d.done("tcp", "127.0.0.1:80", nil); !ok {
+		t.Error("successful dial is not counted")
+	}
+
+	if _, ok := d.done("tcp", "[::1]:80", nil); ok {
+		t.Error("second successful dial is counted")
+	}
+}